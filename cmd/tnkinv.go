@@ -1,27 +1,68 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"math"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"../pkg/archive"
 	"../pkg/aux"
+	"../pkg/candles"
+	"../pkg/catalog"
 	"../pkg/client"
+	"../pkg/emulator"
 	"../pkg/portfolio"
+	"../pkg/schema"
+	"../pkg/source"
 )
 
 type config struct {
 	token, sideOps, fictOps, period, format, acc string
 
+	cacheDir, cacheAction string
+
+	catalogAction, catalogQuery string
+
+	recordDir, replayDir string
+
+	apiURL, scenario, listen string
+
+	pricesDir string
+
+	timeout, deadline time.Duration
+
+	maxCashDiff float64
+	riskFree    float64
+
+	year      int
+	lotMethod schema.LotMethod
+	byAccount bool
+	twr       bool
+
+	actions *schema.Actions
+	bonds   *schema.Bonds
+
+	household *schema.Household
+
+	targets  *schema.Targets
+	cashOnly bool
+
 	tickers []string
+	figis   []string
 
 	start, end, at time.Time
 
-	startSet bool
+	startSet, atSet bool
 }
 
 func parseDate(s string, def time.Time) (time.Time, bool) {
@@ -56,6 +97,14 @@ func parseCmdline() (string, config) {
 		"story",
 		"deals",
 		"price",
+		"cache",
+		"emulate",
+		"catalog",
+		"reconcile",
+		"realized",
+		"tax",
+		"iis",
+		"rebalance",
 	)
 
 	if !cmds.Has(cmd) {
@@ -63,6 +112,35 @@ func parseCmdline() (string, config) {
 		log.Fatalf("unknown command %s", cmd)
 	}
 
+	args := os.Args[2:]
+
+	if cmd == "cache" {
+		if len(args) < 1 || !aux.IsIn(args[0], "clear", "stats") {
+			usage()
+			log.Fatal("cache needs clear|stats")
+		}
+		cfg.cacheAction = args[0]
+		args = args[1:]
+	}
+
+	if cmd == "catalog" {
+		if len(args) < 1 || !aux.IsIn(args[0], "sync", "search") {
+			usage()
+			log.Fatal("catalog needs sync|search")
+		}
+		cfg.catalogAction = args[0]
+		args = args[1:]
+
+		if cfg.catalogAction == "search" {
+			if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+				usage()
+				log.Fatal("catalog search needs text")
+			}
+			cfg.catalogQuery = args[0]
+			args = args[1:]
+		}
+	}
+
 	// ------------
 	// List options
 
@@ -72,22 +150,67 @@ func parseCmdline() (string, config) {
 	fictOps := fs.String("fictives", "", "json file with fictive operations")
 	acc := fs.String("account", "broker", "account")
 	loglevel := fs.String("loglevel", "none", "log level")
+	cacheDir := fs.String("cache-dir", candles.DefaultStoreDir(), "where to keep candles between runs (empty: nowhere)")
+	record := fs.String("record", "", "save API requests and responses to this dir")
+	replay := fs.String("replay", "", "serve API requests from this dir instead of network")
+	apiURL := fs.String("api-url", "", "OpenAPI base path (default: tinkoff)")
+	scenario := fs.String("scenario", "", "emulator scenario file")
+	listen := fs.String("listen", "127.0.0.1:8080", "emulator address")
+	prices := fs.String("prices", "", "dir with csv price archive, preferred to API candles")
+	timeout := fs.Duration("timeout", 30*time.Second, "limit for a single API request (0: none)")
+	deadline := fs.Duration("deadline", 0, "limit for the whole run (0: none)")
+	actions := fs.String("actions", "", "json file with corporate actions (default: built in)")
+	bonds := fs.String("bonds", "", "json file with bond schedules (default: built in)")
+	sections := fs.String("sections", "", "json file with sections and benchmarks of instruments (over the built in ones)")
+	household := fs.String("household", "", "json file with the owners' tokens and accounts (instead of --token)")
+	targets := fs.String("targets", "", "json file with the target weights of sections or tickers")
+	cashOnly := fs.Bool("cash-only", false, "rebalance with the cash only, no sells")
 
 	period := fs.String("period", "", "story period")
 	start := fs.String("start", "", "starting point in time (format: 1922/12/28; default: year ago)")
 	end := fs.String("end", "", "end point in time (format: 1922/12/28; default: now)")
 	atTime := fs.String("at", "", "point in time (default: now). Not supported yet")
 	format := fs.String("format", "human", "output format")
+	year := fs.Int("year", time.Now().Year(), "tax year")
+	lots := fs.String("lots", "fifo", "how sells are matched to buys: fifo|lifo|average")
+	byAccount := fs.Bool("by-account", false, "show, story and deals: every account next to the total")
+	twr := fs.Bool("twr", false, "show: the time-weighted returns (values the portfolio at every day of the flows)")
+	maxCashDiff := fs.Float64("max-cash-diff", 0, "fail if computed cash differs from the broker's more (0: just print)")
+	riskFree := fs.Float64("risk-free", 0, "annual risk-free rate in % for the story's risk metrics")
 	tickers := fs.String("tickers", "", "list of tickers")
+	figis := fs.String("figi", "", "list of figis")
 
-	fs.Parse(os.Args[2:])
+	fs.Parse(args)
 
 	cfg.token = *token
+	cfg.cacheDir = *cacheDir
+	cfg.recordDir = *record
+	cfg.replayDir = *replay
+	cfg.apiURL = *apiURL
+	cfg.scenario = *scenario
+	cfg.listen = *listen
+	cfg.pricesDir = *prices
+	cfg.timeout = *timeout
+	cfg.deadline = *deadline
+	cfg.maxCashDiff = *maxCashDiff
+	cfg.riskFree = *riskFree / 100
+	cfg.year = *year
+
+	if cfg.recordDir != "" && cfg.replayDir != "" {
+		log.Fatal("cannot record and replay at once")
+	}
+	if cfg.recordDir != "" || cfg.replayDir != "" {
+		// everything has to go through the recording: no candles or instruments from the cache
+		cfg.cacheDir = ""
+	}
 	cfg.sideOps = *sideOps
 	cfg.fictOps = *fictOps
 	if *tickers != "" {
 		cfg.tickers = strings.Split(*tickers, ",")
 	}
+	if *figis != "" {
+		cfg.figis = strings.Split(*figis, ",")
+	}
 
 	// ----------------
 	// Verify log level
@@ -128,6 +251,68 @@ func parseCmdline() (string, config) {
 	}
 	cfg.acc = *acc
 
+	// -----------------
+	// Verify lot method
+
+	lotMethods := aux.NewList(
+		string(schema.LotFifo),
+		string(schema.LotLifo),
+		string(schema.LotAverage),
+	)
+	if !lotMethods.Has(*lots) {
+		log.Fatalf("bad lot method %s", *lots)
+	}
+	cfg.lotMethod = schema.LotMethod(*lots)
+	cfg.byAccount = *byAccount
+	cfg.cashOnly = *cashOnly
+	cfg.twr = *twr
+
+	// ------------------------------------------
+	// Load corporate actions, bond schedules and sections
+
+	var err error
+	if cfg.actions, err = schema.LoadActions(*actions); err != nil {
+		log.Fatalf("bad corporate actions: %s", err)
+	}
+	if cfg.bonds, err = schema.LoadBonds(*bonds); err != nil {
+		log.Fatalf("bad bond schedules: %s", err)
+	}
+	if *sections != "" {
+		c, err := schema.LoadClassification(*sections)
+		if err != nil {
+			log.Fatalf("bad sections: %s", err)
+		}
+		schema.UseClassification(c)
+	}
+
+	// ------------
+	// Load targets
+
+	if cmd == "rebalance" {
+		if *targets == "" {
+			usage()
+			log.Fatal("rebalance needs --targets")
+		}
+		if cfg.targets, err = schema.LoadTargets(*targets); err != nil {
+			log.Fatalf("bad targets: %s", err)
+		}
+	}
+
+	// --------------
+	// Load household
+
+	if *household != "" {
+		if cfg.household, err = schema.LoadHousehold(*household); err != nil {
+			log.Fatalf("bad household: %s", err)
+		}
+		if cfg.token != "" {
+			log.Fatal("--token or --household, not both")
+		}
+		if cfg.recordDir != "" || cfg.replayDir != "" {
+			log.Fatal("cannot record or replay a household")
+		}
+	}
+
 	// --------------
 	// Verify period
 
@@ -148,7 +333,7 @@ func parseCmdline() (string, config) {
 
 	cfg.start, cfg.startSet = parseDate(*start, time.Now().AddDate(-1, 0, 0))
 	cfg.end, _ = parseDate(*end, time.Now())
-	cfg.at, _ = parseDate(*atTime, time.Now())
+	cfg.at, cfg.atSet = parseDate(*atTime, time.Now())
 
 	return cmd, cfg
 }
@@ -158,30 +343,85 @@ func usage() {
 		"\t tnkinv {subcmd} [params] --token file_with_token \n" +
 		"\t   common params: \n" +
 		"\t     --account broker|iis|all \n" +
+		"\t     --by-account (show, story and deals: every account next to the total) \n" +
+		"\t     --household filename (owners with their tokens and accounts; instead of --token) \n" +
 		"\t     --operations filename \n" +
 		"\t     --fictives filename \n" +
 		"\t     --loglevel {debug|all} \n" +
+		"\t     --cache-dir dirname (default: user cache dir; empty: no cache) \n" +
+		"\t     --record dirname | --replay dirname \n" +
+		"\t     --api-url http://127.0.0.1:8080/ (default: tinkoff; token is optional then) \n" +
+		"\t     --prices dirname (csv price archive: FIGI.csv or TICKER.csv) \n" +
+		"\t     --timeout 30s (per request; 0: none) \n" +
+		"\t     --deadline 10m (whole run; default: none; Ctrl-C stops too) \n" +
+		"\t     --actions filename (corporate actions; default: built in) \n" +
+		"\t     --bonds filename (bond schedules; default: built in) \n" +
+		"\t     --sections filename (sections and benchmarks; added to the built in ones) \n" +
 		"\t   subcmds: \n" +
 		"\t     show   [--at 1922/12/28 (default: today)] \n" +
+		"\t            [--max-cash-diff 1.0 (default: 0, never fail)] \n" +
+		"\t            [--twr (the time-weighted returns; a valuation per day of the flows)] \n" +
 		"\t     story  [--start 1901/01/01 (default: year ago)] \n" +
 		"\t            [--period day|week|month (default: month)] \n" +
 		"\t            [--format human|table (default: human)] \n" +
+		"\t            [--risk-free 7.5 (annual, in percent; default: 0)] \n" +
+		"\t            [--tickers ticker1,.. | --figi figi1,.. (per position)] \n" +
 		"\t     deals  [--start 1901/01/01 (default: none)] \n" +
 		"\t            [--end 1902/02/02 (default: now)] \n" +
 		"\t            [--period day|week|month|all (default: month)] \n" +
 		"\t     price  --tickers ticker1,ticker2,.. \n" +
 		"\t            [--start 1901/01/01 (default: year ago)] \n" +
 		"\t            [--end 1902/02/02 (default: now)] \n" +
-		"\t     sandbox \n")
+		"\t     reconcile (positions and cash vs the broker's) \n" +
+		"\t     realized [--year 2025 (default: this one)] \n" +
+		"\t            [--lots fifo|lifo|average (default: fifo)] \n" +
+		"\t     tax    [--year 2025 (default: this one)] \n" +
+		"\t     iis    (payins, deductions and term of the IIS accounts) \n" +
+		"\t     rebalance --targets filename \n" +
+		"\t            [--cash-only (no sells)] \n" +
+		"\t            [--format human|table (default: human)] \n" +
+		"\t     sandbox \n" +
+		"\t     cache  clear|stats \n" +
+		"\t     catalog sync | search \"text\" (name, ticker or isin) \n" +
+		"\t     emulate --scenario filename \n" +
+		"\t            [--listen 127.0.0.1:8080] \n")
 }
 
-func getAccountIds(c *client.MyClient, accType string) (accIds []string) {
+func newClient(cfg config, tokenf string) *client.MyClient {
+	c := client.NewClient(tokenf).WithTimeout(cfg.timeout)
+
+	if cfg.apiURL != "" {
+		c = c.WithBasePath(cfg.apiURL)
+	}
+
+	var err error
+	if cfg.recordDir != "" {
+		c, err = c.WithRecording(cfg.recordDir)
+	} else if cfg.replayDir != "" {
+		c, err = c.WithReplay(cfg.replayDir)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return c
+}
+
+func getAccountIds(ctx context.Context, c *client.MyClient, accType string) (accIds []string) {
 	if accType == "broker" {
 		accIds = append(accIds, "")
 		return
 	}
 
-	for _, acc := range c.RequestAccounts().Payload.Accounts {
+	resp, err := c.RequestAccounts(ctx)
+	if stopped(err) {
+		// the subcommand stops on the context too
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, acc := range resp.Payload.Accounts {
 		if accType == "all" || acc.BrokerAccountType == "TinkoffIis" {
 			accIds = append(accIds, acc.BrokerAccountID)
 		}
@@ -189,38 +429,345 @@ func getAccountIds(c *client.MyClient, accType string) (accIds []string) {
 	return
 }
 
+// candleStore is only of the real API: the candles of an emulator or an archive
+// would be kept as closed ones and override the broker's in later runs
+func candleStore(cfg config) *candles.Store {
+	if cfg.cacheDir == "" || cfg.apiURL != "" || cfg.pricesDir != "" {
+		return nil
+	}
+	return candles.NewStore(filepath.Join(cfg.cacheDir, "candles"))
+}
+
+func cache(cfg config) {
+	if cfg.cacheDir == "" {
+		log.Fatal("no cache dir")
+	}
+	store := candles.NewStore(filepath.Join(cfg.cacheDir, "candles"))
+
+	if cfg.cacheAction == "clear" {
+		if err := store.Clear(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	stats, err := store.Stats()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("%s: %d files, %.1f MB\n", store.Dir(), stats.Files, float64(stats.Bytes)/1024/1024)
+	for _, interval := range []string{"day", "week", "month"} {
+		if n := stats.Candles[interval]; n != 0 {
+			fmt.Printf("  %-5s candles: %d\n", interval, n)
+		}
+	}
+}
+
+// loadCatalog is of the real API only, an emulator's instruments are not to get into it
+func loadCatalog(cfg config, fallback source.Instruments) *catalog.Catalog {
+	if cfg.cacheDir == "" || cfg.apiURL != "" {
+		return nil
+	}
+
+	cat, err := catalog.Load(catalog.DefaultFile(cfg.cacheDir), fallback)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return cat
+}
+
+func searchCatalog(cfg config) {
+	cat := loadCatalog(cfg, nil)
+	if cat == nil {
+		log.Fatal("no cache dir")
+	}
+	if cat.Len() == 0 {
+		log.Fatal("catalog is empty, run `catalog sync` first")
+	}
+
+	for _, mi := range cat.Search(cfg.catalogQuery, 20) {
+		fmt.Printf("%-12s %-12s %-12s %-8s %s %5d %g  %s\n",
+			mi.Ticker, mi.Figi, mi.Isin, mi.Type, mi.Currency, mi.Lot, mi.MinPriceIncrement, mi.Name)
+	}
+}
+
+func syncCatalog(ctx context.Context, cfg config, c *client.MyClient) {
+	if cfg.apiURL != "" {
+		log.Fatal("catalog sync is for the tinkoff API only, not --api-url")
+	}
+	cat := loadCatalog(cfg, c)
+	if cat == nil {
+		log.Fatal("no cache dir")
+	}
+
+	if err := cat.Sync(ctx, c); err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("catalog: %d instruments", cat.Len())
+}
+
+// checkCash prints computed vs reported cash; it is only possible for today
+// and for the operations that all come from the broker
+func checkCash(port *portfolio.Portfolio, cfg config) {
+	if cfg.atSet || cfg.sideOps != "" || cfg.fictOps != "" {
+		log.Debug("cash check skipped")
+		return
+	}
+
+	diffs, err := port.CheckCash()
+	if err != nil {
+		log.Warnf("no cash check: %s", err)
+		return
+	}
+
+	portfolio.PrintCash(diffs)
+
+	for _, d := range diffs {
+		if cfg.maxCashDiff > 0 && math.Abs(d.Diff()) > cfg.maxCashDiff {
+			log.Fatalf("%s cash mismatch %.2f is above %.2f", d.Currency, d.Diff(), cfg.maxCashDiff)
+		}
+	}
+}
+
+// reconcile lists where the positions rebuilt out of the operations differ from the broker's
+func reconcile(port *portfolio.Portfolio, cfg config) {
+	if cfg.sideOps != "" || cfg.fictOps != "" {
+		log.Fatal("reconcile needs the broker operations only")
+	}
+
+	if err := port.Collect(time.Now()); err != nil {
+		log.Fatal(err)
+	}
+
+	ds, err := port.ReconcilePositions()
+	if err != nil {
+		log.Fatal(err)
+	}
+	portfolio.PrintDiscrepancies(ds)
+
+	diffs, err := port.CheckCash()
+	if err != nil {
+		log.Fatal(err)
+	}
+	portfolio.PrintCash(diffs)
+
+	n := len(ds)
+	for _, d := range diffs {
+		if math.Abs(d.Diff()) >= 0.01 {
+			n++
+		}
+	}
+	if n != 0 {
+		log.Fatalf("%d discrepancies", n)
+	}
+}
+
+func emulate(cfg config) {
+	if cfg.scenario == "" {
+		usage()
+		log.Fatal("no scenario provided")
+	}
+
+	sc, err := emulator.LoadScenario(cfg.scenario)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Infof("emulating OpenAPI at http://%s/", cfg.listen)
+	log.Fatal(http.ListenAndServe(cfg.listen, emulator.NewServer(sc)))
+}
+
+// stopped tells Ctrl-C or the deadline
+func stopped(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// interrupted warns about a stopped run; any other error is fatal
+func interrupted(err error) {
+	if err == nil {
+		return
+	}
+	if !stopped(err) {
+		log.Fatal(err)
+	}
+	log.Warnf("interrupted (%s), the output is incomplete", err)
+}
+
 func main() {
 	cmd, cfg := parseCmdline()
 
-	if cfg.token == "" {
+	if cmd == "cache" {
+		cache(cfg)
+		return
+	}
+
+	if cmd == "emulate" {
+		emulate(cfg)
+		return
+	}
+
+	if cmd == "catalog" && cfg.catalogAction == "search" {
+		searchCatalog(cfg)
+		return
+	}
+
+	if cfg.token == "" && cfg.household == nil && cfg.replayDir == "" && cfg.apiURL == "" {
 		usage()
 		log.Fatal("no token provided")
 	}
 
-	c := client.NewClient(cfg.token)
+	// Ctrl-C and the deadline stop the requests; what was computed by then is printed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		// the second Ctrl-C kills
+		<-ctx.Done()
+		stop()
+	}()
+
+	if cfg.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.deadline)
+		defer cancel()
+	}
+
+	// c is the market one; the accounts are of the household owners' clients, if there is one
+	var c *client.MyClient
+	var accSrc source.Source
+	var accountIds func(accType string) []string
+
+	if cfg.household == nil {
+		c = newClient(cfg, cfg.token)
+		defer c.Stop()
+
+		accSrc = c
+		accountIds = func(accType string) []string {
+			return getAccountIds(ctx, c, accType)
+		}
+	} else {
+		joint := source.NewJoint()
+		var clients []*client.MyClient
+		for _, o := range cfg.household.Owners {
+			oc := newClient(cfg, o.Token)
+			defer oc.Stop()
+
+			joint.Add(o.Name, oc)
+			clients = append(clients, oc)
+		}
+		c = clients[0]
+
+		accSrc = joint
+		accountIds = func(accType string) (accIds []string) {
+			for i, o := range cfg.household.Owners {
+				t := accType
+				if t == "" {
+					t = o.Account
+				}
+				for _, acc := range getAccountIds(ctx, clients[i], t) {
+					accIds = append(accIds, source.JointAccount(o.Name, acc))
+				}
+			}
+			return
+		}
+	}
 
 	if cmd == "sandbox" {
-		c.TrySandbox()
-		c.Stop()
+		if err := c.TrySandbox(ctx); err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
+	if cmd == "catalog" {
+		syncCatalog(ctx, cfg, c)
 		return
 	}
 
+	src := accSrc
+	if cat := loadCatalog(cfg, c); cat != nil && cat.Len() != 0 {
+		src = source.WithInstruments(src, cat)
+	}
+	if cfg.pricesDir != "" {
+		src = source.WithMarket(src, archive.New(cfg.pricesDir, src))
+	}
+
 	if cmd == "price" {
-		portfolio.GetPrices(c, cfg.tickers, cfg.start, cfg.end, cfg.period, cfg.format)
+		err := portfolio.GetPrices(ctx, src, candleStore(cfg), cfg.actions, cfg.bonds, cfg.tickers, cfg.start, cfg.end, cfg.period, cfg.format)
+		interrupted(err)
 		return
 	}
 
-	port := portfolio.NewPortfolio(c, getAccountIds(c, cfg.acc), cfg.sideOps, cfg.fictOps)
+	if (cfg.byAccount || cfg.household != nil) && (cfg.sideOps != "" || cfg.fictOps != "") {
+		log.Fatal("--by-account and --household need the broker operations only")
+	}
+
+	accType := cfg.acc
+	if cfg.household != nil {
+		// the owners' ones
+		accType = ""
+	}
+
+	port := portfolio.NewPortfolio(ctx, src, accountIds(accType), cfg.sideOps, cfg.fictOps).
+		WithCandleStore(candleStore(cfg)).
+		WithLotMethod(cfg.lotMethod).
+		WithActions(cfg.actions).
+		WithBonds(cfg.bonds).
+		WithByAccount(cfg.byAccount).
+		WithByOwner(cfg.household != nil).
+		WithTwr(cfg.twr)
 
 	if cmd == "show" {
-		port.Collect(cfg.at)
+		err := port.Collect(cfg.at)
+		if err != nil && !stopped(err) {
+			log.Fatal(err)
+		}
 		port.Print(cfg.at)
+		if err == nil {
+			checkCash(port, cfg)
+		}
+		interrupted(err)
+		return
+	}
+
+	if cmd == "realized" {
+		interrupted(port.ListRealized(cfg.year))
+		return
+	}
+
+	if cmd == "tax" {
+		if cfg.sideOps != "" || cfg.fictOps != "" {
+			log.Fatal("tax needs the broker operations only")
+		}
+		interrupted(port.ListTax(cfg.year))
+		return
+	}
+
+	if cmd == "iis" {
+		if cfg.sideOps != "" || cfg.fictOps != "" {
+			log.Fatal("iis needs the broker operations only")
+		}
+		// of all the accounts, so that the transfers out of the IIS ones are marked
+		iis := portfolio.NewPortfolio(ctx, src, accountIds("all"), "", "").
+			WithActions(cfg.actions).
+			WithBonds(cfg.bonds)
+		interrupted(iis.ListIis(accountIds("iis")))
+		return
+	}
+
+	if cmd == "reconcile" {
+		reconcile(port, cfg)
+		return
+	}
+
+	if cmd == "rebalance" {
+		interrupted(port.Rebalance(cfg.targets, c, !cfg.cashOnly, cfg.format))
 		return
 	}
 
 	if cmd == "deals" {
 		if cfg.startSet {
-			port.ListDeals(cfg.start, cfg.end)
+			interrupted(port.ListDeals(cfg.start, cfg.end))
 			return
 		}
 
@@ -243,7 +790,7 @@ func main() {
 			since = time.Time{}
 		}
 
-		port.ListDeals(since, cfg.end)
+		interrupted(port.ListDeals(since, cfg.end))
 		return
 	}
 
@@ -252,7 +799,12 @@ func main() {
 			cfg.period = "month"
 		}
 
-		port.ListBalances(cfg.start, cfg.period, cfg.format)
+		if len(cfg.tickers) > 0 || len(cfg.figis) > 0 {
+			interrupted(port.ListPositionStory(cfg.tickers, cfg.figis, cfg.start, cfg.period, cfg.format))
+			return
+		}
+
+		interrupted(port.WithRiskFree(cfg.riskFree).ListBalances(cfg.start, cfg.period, cfg.format))
 		return
 	}
 }
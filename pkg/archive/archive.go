@@ -0,0 +1,228 @@
+package archive
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"../schema"
+	"../source"
+)
+
+/* Archive serves candles out of local csv files, one per instrument:
+     <dir>/<FIGI>.csv or <dir>/<TICKER>.csv
+   with a header naming at least the date and close columns, e.g.
+     date,open,high,low,close,volume                         (plain)
+     <TICKER>,<PER>,<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>   (MOEX/finam export)
+   Daily rows are expected; weeks and months are built out of them.
+   Whatever is not in the archive is passed to the fallback source. */
+
+type Archive struct {
+	source.Market
+
+	dir string
+
+	mu    sync.Mutex
+	files map[string][]day // key=figi; nil if there is no file
+}
+
+type day struct {
+	time  time.Time
+	open  float64
+	high  float64
+	low   float64
+	close float64
+	vol   float64
+}
+
+func New(dir string, fallback source.Market) *Archive {
+	return &Archive{
+		Market: fallback,
+		dir:    dir,
+		files:  make(map[string][]day),
+	}
+}
+
+var dateFormats = []string{"2006-01-02", "20060102", "02.01.2006", "2006/01/02"}
+
+func parseDate(s string) (time.Time, error) {
+	for _, f := range dateFormats {
+		if t, err := time.Parse(f, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown date format %q", s)
+}
+
+func readFile(fname string) ([]day, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comma = ','
+	if strings.HasSuffix(fname, ".txt") {
+		r.Comma = ';'
+	}
+
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fname, err)
+	}
+	if len(rows) < 2 {
+		return nil, fmt.Errorf("%s: no data", fname)
+	}
+
+	cols := make(map[string]int)
+	for i, name := range rows[0] {
+		cols[strings.Trim(strings.ToLower(strings.TrimSpace(name)), "<>")] = i
+	}
+
+	dateCol, hasDate := cols["date"]
+	closeCol, hasClose := cols["close"]
+	if !hasDate || !hasClose {
+		return nil, fmt.Errorf("%s: no date or close column", fname)
+	}
+
+	field := func(row []string, name string, def float64) float64 {
+		i, ok := cols[name]
+		if !ok || i >= len(row) {
+			return def
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(row[i]), 64)
+		if err != nil {
+			return def
+		}
+		return v
+	}
+
+	var days []day
+	for n, row := range rows[1:] {
+		t, err := parseDate(strings.TrimSpace(row[dateCol]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", fname, n+2, err)
+		}
+		c, err := strconv.ParseFloat(strings.TrimSpace(row[closeCol]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", fname, n+2, err)
+		}
+
+		days = append(days, day{
+			time:  t,
+			open:  field(row, "open", c),
+			high:  field(row, "high", c),
+			low:   field(row, "low", c),
+			close: c,
+			vol:   field(row, "vol", field(row, "volume", 0)),
+		})
+	}
+
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].time.Before(days[j].time)
+	})
+	return days, nil
+}
+
+// load finds the file for figi, by the figi itself or by its ticker
+func (a *Archive) load(ctx context.Context, figi string) []day {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if days, ok := a.files[figi]; ok {
+		return days
+	}
+	a.files[figi] = nil
+
+	names := []string{figi}
+	if ins, err := a.Market.RequestByFigi(ctx, figi); err == nil {
+		names = append(names, ins.Ticker)
+	}
+
+	for _, name := range names {
+		for _, ext := range []string{".csv", ".txt"} {
+			fname := filepath.Join(a.dir, name+ext)
+			if _, err := os.Stat(fname); err != nil {
+				continue
+			}
+
+			days, err := readFile(fname)
+			if err != nil {
+				log.Warnf("price archive: %s", err)
+				return nil
+			}
+
+			log.Debugf("price archive: %s for %s, %d days", fname, figi, len(days))
+			a.files[figi] = days
+			return days
+		}
+	}
+	return nil
+}
+
+func candleStart(t time.Time, interval string) time.Time {
+	switch interval {
+	case "week":
+		return t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+	return t
+}
+
+func (a *Archive) RequestCandles(ctx context.Context, figi string, t1, t2 time.Time, interval string) (schema.CandlesResponse, error) {
+	days := a.load(ctx, figi)
+	if days == nil || !supported(interval) {
+		return a.Market.RequestCandles(ctx, figi, t1, t2, interval)
+	}
+
+	resp := schema.CandlesResponse{}
+	resp.Payload.Figi = figi
+	resp.Payload.Interval = interval
+
+	pcandles := []schema.Candle{}
+	for _, d := range days {
+		if d.time.Before(t1) || !d.time.Before(t2) {
+			continue
+		}
+
+		start := candleStart(d.time, interval).Format(time.RFC3339)
+		if n := len(pcandles); n > 0 && pcandles[n-1].Time == start {
+			c := &pcandles[n-1]
+			c.C = d.close
+			c.H = math.Max(c.H, d.high)
+			c.L = math.Min(c.L, d.low)
+			c.V += d.vol
+			continue
+		}
+
+		pcandles = append(pcandles, schema.Candle{
+			Figi:     figi,
+			Interval: interval,
+			Time:     start,
+			O:        d.open,
+			C:        d.close,
+			H:        d.high,
+			L:        d.low,
+			V:        d.vol,
+		})
+	}
+
+	resp.Payload.Candles = pcandles
+	return resp, nil
+}
+
+func supported(interval string) bool {
+	return interval == "day" || interval == "week" || interval == "month"
+}
@@ -0,0 +1,73 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"../schema"
+)
+
+// fakeMarket knows a single instrument and has no candles
+type fakeMarket struct {
+	candleCalls int
+}
+
+func (m *fakeMarket) RequestByFigi(ctx context.Context, figi string) (schema.Instrument, error) {
+	if figi != "FIGI1" {
+		return schema.Instrument{}, errors.New("not found")
+	}
+	return schema.NewInstrument("FIGI1", "TCK", "Test", "Stock", "RUB", 0, 1), nil
+}
+
+func (m *fakeMarket) RequestByTicker(ctx context.Context, ticker string) (schema.Instrument, error) {
+	return m.RequestByFigi(ctx, "FIGI1")
+}
+
+func (m *fakeMarket) RequestCandles(ctx context.Context, figi string, t1, t2 time.Time, interval string) (schema.CandlesResponse, error) {
+	m.candleCalls++
+	return schema.CandlesResponse{}, nil
+}
+
+func (m *fakeMarket) RequestCurrentPrice(ctx context.Context, figi string) (float64, error) {
+	return 0, nil
+}
+
+func TestArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := "<TICKER>,<PER>,<DATE>,<TIME>,<OPEN>,<HIGH>,<LOW>,<CLOSE>,<VOL>\n" +
+		"TCK,D,20200106,000000,10,12,9,11,100\n" +
+		"TCK,D,20200107,000000,11,13,10,12,100\n" +
+		"TCK,D,20200113,000000,12,12,8,9,100\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, "TCK.csv"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	m := &fakeMarket{}
+	a := New(dir, m)
+
+	t1, t2 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	resp, err := a.RequestCandles(ctx, "FIGI1", t1, t2, "week")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcandles := resp.Payload.Candles
+	if len(pcandles) != 2 || pcandles[0].C != 12 || pcandles[0].H != 13 || pcandles[1].L != 8 {
+		t.Errorf("weekly candles: %+v", pcandles)
+	}
+
+	if _, err = a.RequestCandles(ctx, "FIGI2", t1, t2, "day"); err != nil || m.candleCalls != 1 {
+		t.Errorf("unknown figi was not passed to the fallback: %v", err)
+	}
+}
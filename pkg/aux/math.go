@@ -1,6 +1,8 @@
 package aux
 
 import (
+	"errors"
+	"fmt"
 	"math"
 	"time"
 
@@ -11,6 +13,14 @@ func Ratio2Perc(ratio float64) float64 {
 	return (ratio - 1) * 100
 }
 
+// PercOrNA formats the ratio as percent, "n/a" of the same width if there is none
+func PercOrNA(format string, ratio float64, err error) string {
+	if err != nil || math.IsNaN(ratio) {
+		return fmt.Sprintf("%*s", len(fmt.Sprintf(format, 0.0)), "n/a")
+	}
+	return fmt.Sprintf(format, ratio*100)
+}
+
 func RatioAnnual(ratio float64, delta time.Duration) float64 {
 	return math.Pow(ratio, 365/(delta.Hours()/24))
 }
@@ -34,44 +44,121 @@ func (ctx *XirrCtx) AddPayment(val float64, date time.Time) {
 	})
 }
 
-func (ctx XirrCtx) Ratio(result float64, tn time.Time) float64 {
-	epsilon := result / 100000.0
-	if epsilon < 0.1 {
-		epsilon = 0.1
+var ErrNoXirr = errors.New("no xirr")
+
+const (
+	xirrMinRate = -1 // everything lost
+	xirrMaxIter = 100
+)
+
+// npv is the value the payments would have grown to by tn at the rate, less the result; and its derivative
+func (ctx XirrCtx) npv(rate, result float64, tn time.Time) (float64, float64) {
+	nv, d := -result, 0.0
+	for _, p := range ctx.payments {
+		years := tn.Sub(p.date).Hours() / 24.0 / 365.0
+		nv += p.val * math.Pow(1+rate, years)
+		d += p.val * years * math.Pow(1+rate, years-1)
 	}
+	return nv, d
+}
 
+// bracket finds the rates the npv changes its sign between, the lowest ones first
+func (ctx XirrCtx) bracket(result float64, tn time.Time) (float64, float64, bool) {
+	grid := []float64{xirrMinRate, -0.99, -0.9, -0.5, -0.2, 0, 0.2, 0.5, 1, 2, 5, 10, 100, 1000}
+
+	prev, _ := ctx.npv(grid[0], result, tn)
+	for i := 1; i < len(grid); i++ {
+		nv, _ := ctx.npv(grid[i], result, tn)
+		if prev == 0 {
+			return grid[i-1], grid[i-1], true
+		}
+		if prev < 0 && nv >= 0 || prev > 0 && nv <= 0 {
+			return grid[i-1], grid[i], true
+		}
+		prev = nv
+	}
+	return 0, 0, false
+}
+
+// Ratio is the annual rate the payments grow at to the result by tn: 0.1 for 10%.
+// Newton-Raphson steps are kept within a bracket of the root and replaced by bisection
+// when they leave it or stall; ErrNoXirr if there is no rate in [-100%, 100000%] or it does not converge.
+func (ctx XirrCtx) Ratio(result float64, tn time.Time) (float64, error) {
 	if len(ctx.payments) == 0 {
-		return 0
+		return 0, ErrNoXirr
+	}
+
+	lo, hi, ok := ctx.bracket(result, tn)
+	if !ok {
+		return 0, ErrNoXirr
+	}
+	if lo == hi {
+		return lo, nil
+	}
+
+	nvLo, _ := ctx.npv(lo, result, tn)
+
+	// npv is in money, so is the tolerance
+	scale := math.Abs(result)
+	for _, p := range ctx.payments {
+		scale = math.Max(scale, math.Abs(p.val))
 	}
+	epsilon := scale * 1e-10
 
-	rate := 0.2
-	rate_down, rate_up, have_rate_down, have_rate_up := 0.0, 0.0, false, false
-	i := 0
+	rate, prevNv := (lo+hi)/2, math.Inf(1)
+	for i := 0; i < xirrMaxIter; i++ {
+		nv, d := ctx.npv(rate, result, tn)
+		log.Tracef("xirr %d: rate %f nv %f [%f, %f]", i, rate, nv, lo, hi)
 
-	for i = 0; ; i++ {
-		nv := -result
-		for _, p := range ctx.payments {
-			nv += p.val * math.Pow(1+rate, tn.Sub(p.date).Hours()/24.0/365.0)
+		if math.Abs(nv) < epsilon || hi-lo < 1e-12 {
+			return rate, nil
 		}
-		log.Tracef("total %.2f e %f rate %f nv %f", result, epsilon, rate, nv)
-		if nv < -epsilon {
-			rate_down, have_rate_down = rate, true
-			if have_rate_up {
-				rate = (rate + rate_up) / 2
-			} else {
-				rate += 0.1
-			}
-		} else if nv > epsilon {
-			rate_up, have_rate_up = rate, true
-			if have_rate_down {
-				rate = (rate + rate_down) / 2
-			} else {
-				rate -= 0.1
-			}
+
+		// keep the root in [lo, hi]
+		if (nv < 0) == (nvLo < 0) {
+			lo, nvLo = rate, nv
 		} else {
-			break
+			hi = rate
+		}
+
+		next := rate - nv/d
+		stalled := math.Abs(nv) > math.Abs(prevNv)/2
+		if d == 0 || math.IsNaN(next) || next <= lo || next >= hi || stalled {
+			next = (lo + hi) / 2
 		}
+		rate, prevNv = next, nv
+	}
+	return 0, ErrNoXirr
+}
+
+// =============================================================================
+
+// Twr is the time-weighted return: the returns between the cash flows chained,
+// so that the flows themselves do not count
+type Twr struct {
+	growth float64
+	last   float64 // value after the last flow
+}
+
+// Mark closes the period at the value before the next flows.
+// An empty value breaks the chain: there is no return of nothing.
+func (tw *Twr) Mark(value float64) {
+	tw.growth = tw.Ratio(value)
+	tw.last = value
+}
+
+func (tw *Twr) AddFlow(flow float64) {
+	tw.last += flow
+}
+
+// Ratio is 1 + the return till the value
+func (tw Twr) Ratio(value float64) float64 {
+	growth := tw.growth
+	if growth == 0 {
+		growth = 1
+	}
+	if tw.last > 0 && value > 0 {
+		growth *= value / tw.last
 	}
-	log.Infof("xirr took %d iterations, rate=%.2f, e=%.1f", i, rate, epsilon)
-	return rate
+	return growth
 }
@@ -1,6 +1,7 @@
 package aux
 
 import (
+	"math"
 	"testing"
 	"time"
 )
@@ -13,8 +14,56 @@ func TestXirr(t *testing.T) {
 	var ctx XirrCtx
 	ctx.AddPayment(100, date(2002, 1, 1))
 	ctx.AddPayment(100, date(2003, 1, 1))
-	rate := ctx.Ratio(231, date(2004, 1, 1))
-	if rate != 0.1 {
-		t.Errorf("xiir() = %f, exp 0.1", rate)
+	rate, err := ctx.Ratio(231, date(2004, 1, 1))
+	if err != nil || math.Abs(rate-0.1) > 1e-9 {
+		t.Errorf("xiir() = %f %v, exp 0.1", rate, err)
+	}
+}
+
+func TestXirrEdges(t *testing.T) {
+	var ctx XirrCtx
+	if _, err := ctx.Ratio(100, date(2004, 1, 1)); err != ErrNoXirr {
+		t.Errorf("no payments: %v", err)
+	}
+
+	ctx.AddPayment(1000, date(2002, 1, 1))
+	for result, exp := range map[float64]float64{
+		250:  -0.5,         // lost 75% in two years
+		1:    -0.968377223, // almost everything
+		1000: 0,
+		4000: 1,
+		0:    -1,
+	} {
+		rate, err := ctx.Ratio(result, date(2004, 1, 1))
+		if err != nil || math.Abs(rate-exp) > 1e-6 {
+			t.Errorf("%g: xirr() = %f %v, exp %f", result, rate, err, exp)
+		}
+	}
+
+	// a tiny portfolio
+	var tiny XirrCtx
+	tiny.AddPayment(0.01, date(2002, 1, 1))
+	if rate, err := tiny.Ratio(0.0121, date(2004, 1, 1)); err != nil || math.Abs(rate-0.1) > 1e-9 {
+		t.Errorf("tiny: xirr() = %f %v, exp 0.1", rate, err)
+	}
+
+	// lost more than everything: no rate explains it
+	if rate, err := ctx.Ratio(-50, date(2004, 1, 1)); err != ErrNoXirr {
+		t.Errorf("no solution: xirr() = %f %v", rate, err)
+	}
+}
+
+func TestTwr(t *testing.T) {
+	var tw Twr
+	tw.Mark(0)
+	tw.AddFlow(100)
+	tw.Mark(110) // +10%
+	tw.AddFlow(1000)
+	tw.Mark(1000) // -9.9%, the deposit does not make it a gain
+	tw.AddFlow(-1000)
+	tw.Mark(0) // all withdrawn, no more returns
+
+	if r, exp := tw.Ratio(0), 1.1*1000/1110; math.Abs(r-exp) > 1e-12 {
+		t.Errorf("twr = %f, exp %f", r, exp)
 	}
 }
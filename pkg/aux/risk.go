@@ -0,0 +1,120 @@
+package aux
+
+import (
+	"math"
+)
+
+/* Risk metrics of a series of periodic returns (0.01 for 1%);
+   periods is how many of them make a year. */
+
+func mean(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	s := 0.0
+	for _, x := range xs {
+		s += x
+	}
+	return s / float64(len(xs))
+}
+
+// covariance is the sample one; xs and ys are of the same length
+func covariance(xs, ys []float64) float64 {
+	if len(xs) < 2 {
+		return 0
+	}
+	mx, my := mean(xs), mean(ys)
+	s := 0.0
+	for i := range xs {
+		s += (xs[i] - mx) * (ys[i] - my)
+	}
+	return s / float64(len(xs)-1)
+}
+
+func stdev(xs []float64) float64 {
+	return math.Sqrt(covariance(xs, xs))
+}
+
+// PeriodRate is the rate of a period out of the annual one
+func PeriodRate(annual, periods float64) float64 {
+	return math.Pow(1+annual, 1/periods) - 1
+}
+
+// Volatility is the annualized standard deviation of the returns
+func Volatility(returns []float64, periods float64) float64 {
+	return stdev(returns) * math.Sqrt(periods)
+}
+
+// MaxDrawdown is the largest fall of the values from a peak, -0.2 for 20%,
+// with the indexes of the peak and the trough; 0, -1, -1 if they never fell
+func MaxDrawdown(values []float64) (dd float64, peak, trough int) {
+	peak, trough = -1, -1
+	top := 0
+	for i, v := range values {
+		if v > values[top] {
+			top = i
+		}
+		if values[top] <= 0 {
+			continue
+		}
+		if d := v/values[top] - 1; d < dd {
+			dd, peak, trough = d, top, i
+		}
+	}
+	return
+}
+
+// Sharpe is the annualized excess return per unit of the volatility; NaN if there is no volatility
+func Sharpe(returns []float64, riskFree, periods float64) float64 {
+	sd := stdev(returns)
+	if sd == 0 {
+		return math.NaN()
+	}
+	return (mean(returns) - PeriodRate(riskFree, periods)) / sd * math.Sqrt(periods)
+}
+
+// Sortino is like Sharpe, but only the returns below the risk-free rate count as risk
+func Sortino(returns []float64, riskFree, periods float64) float64 {
+	rf := PeriodRate(riskFree, periods)
+
+	s := 0.0
+	for _, r := range returns {
+		if r < rf {
+			s += (r - rf) * (r - rf)
+		}
+	}
+	if s == 0 {
+		return math.NaN()
+	}
+	downside := math.Sqrt(s / float64(len(returns)))
+	return (mean(returns) - rf) / downside * math.Sqrt(periods)
+}
+
+// Beta of the returns against the market ones of the same periods; NaN if the market did not move
+func Beta(returns, market []float64) float64 {
+	v := covariance(market, market)
+	if v == 0 {
+		return math.NaN()
+	}
+	return covariance(returns, market) / v
+}
+
+// Correlation of the returns with the market ones of the same periods; NaN if either did not move
+func Correlation(returns, market []float64) float64 {
+	d := stdev(returns) * stdev(market)
+	if d == 0 {
+		return math.NaN()
+	}
+	return covariance(returns, market) / d
+}
+
+// Returns are the relative changes of the values; the ones from a non-positive value are skipped
+func Returns(values []float64) []float64 {
+	var rs []float64
+	for i := 1; i < len(values); i++ {
+		if values[i-1] > 0 {
+			rs = append(rs, values[i]/values[i-1]-1)
+		}
+	}
+	return rs
+}
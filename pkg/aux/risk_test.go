@@ -0,0 +1,61 @@
+package aux
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestRisk(t *testing.T) {
+	values := []float64{100, 110, 99, 108.9, 120, 90, 126}
+	returns := Returns(values)
+	exp := []float64{0.1, -0.1, 0.1, 120/108.9 - 1, -0.25, 0.4}
+	for i := range exp {
+		if !near(returns[i], exp[i]) {
+			t.Fatalf("returns %v, exp %v", returns, exp)
+		}
+	}
+
+	if dd, peak, trough := MaxDrawdown(values); !near(dd, -0.25) || peak != 4 || trough != 5 {
+		t.Errorf("drawdown %.3f %d -> %d, exp -0.25 4 -> 5", dd, peak, trough)
+	}
+	if dd, peak, trough := MaxDrawdown([]float64{1, 2, 3}); dd != 0 || peak != -1 || trough != -1 {
+		t.Errorf("no drawdown: %.3f %d -> %d", dd, peak, trough)
+	}
+
+	// constant returns: no volatility, no downside
+	flat := []float64{0.01, 0.01, 0.01}
+	if v := Volatility(flat, 12); v != 0 {
+		t.Errorf("flat volatility %f", v)
+	}
+	if !math.IsNaN(Sharpe(flat, 0, 12)) || !math.IsNaN(Sortino(flat, 0, 12)) {
+		t.Error("flat sharpe or sortino")
+	}
+
+	rs := []float64{0.02, -0.01, 0.03, 0}
+	// mean 0.01, sample variance (0.0001+0.0004+0.0004+0.0001)/3
+	sd := math.Sqrt(0.001 / 3)
+	if v := Volatility(rs, 4); !near(v, sd*2) {
+		t.Errorf("volatility %f, exp %f", v, sd*2)
+	}
+	if s := Sharpe(rs, 0, 4); !near(s, 0.01/sd*2) {
+		t.Errorf("sharpe %f, exp %f", s, 0.01/sd*2)
+	}
+	if s := Sortino(rs, 0, 4); !near(s, 0.01/math.Sqrt(0.0001/4)*2) {
+		t.Errorf("sortino %f", s)
+	}
+	if !near(PeriodRate(0.21, 2), 0.1) {
+		t.Errorf("period rate %f", PeriodRate(0.21, 2))
+	}
+
+	market := []float64{0.01, -0.005, 0.015, 0}
+	if b := Beta(rs, market); !near(b, 2) {
+		t.Errorf("beta %f, exp 2", b)
+	}
+	if c := Correlation(rs, market); !near(c, 1) {
+		t.Errorf("correlation %f, exp 1", c)
+	}
+}
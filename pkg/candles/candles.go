@@ -1,17 +1,18 @@
 package candles
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"sort"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
-	"../client"
 	"../schema"
+	"../source"
 )
 
-// TODO
 // Candles for amortized bonds are quire fucked up.
 // They show the old values as if it was now.
 // e.g.
@@ -19,6 +20,10 @@ import (
 //   2. grew to 1100
 //   3. amortized to 880
 // candle for the time point (1) is going to show 800.
+// WithBonds corrects them by the schedules; positions do it by their own repayments instead.
+
+// no candles are looked for before that
+var beginning = time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
 
 type candleMap map[string][]candle // key=figi
 
@@ -28,19 +33,99 @@ type candle struct {
 }
 
 type CandleCache struct {
-	client *client.MyClient
-	cache  candleMap
+	ctx   context.Context
+	src   source.Candles
+	cache candleMap
+	store *Store
+
+	actions     *schema.Actions
+	bonds       *schema.Bonds
+	ins         source.Instruments
+	instruments map[string]schema.Instrument // key=figi
 
 	start  time.Time
 	period string
 	pcache candleMap
 }
 
-func NewCandleCache(c *client.MyClient) *CandleCache {
+func NewCandleCache(ctx context.Context, src source.Candles) *CandleCache {
 	return &CandleCache{
-		client: c,
-		cache:  make(candleMap),
+		ctx:   ctx,
+		src:   src,
+		cache: make(candleMap),
+	}
+}
+
+// WithStore makes the cache look up and save the candles on disk
+func (cc *CandleCache) WithStore(s *Store) *CandleCache {
+	cc.store = s
+	return cc
+}
+
+// WithActions makes the cache adjust the prices before splits to the today's units;
+// the instruments source resolves the tickers the actions may be given by
+func (cc *CandleCache) WithActions(a *schema.Actions, ins source.Instruments) *CandleCache {
+	cc.actions = a
+	cc.ins = ins
+	return cc
+}
+
+// WithBonds makes the cache correct the prices of amortized bonds to the nominal of their time
+func (cc *CandleCache) WithBonds(b *schema.Bonds, ins source.Instruments) *CandleCache {
+	cc.bonds = b
+	cc.ins = ins
+	return cc
+}
+
+// instrument is a stub of the figi alone if it is unknown
+func (cc *CandleCache) instrument(figi string) schema.Instrument {
+	if cc.instruments == nil {
+		cc.instruments = make(map[string]schema.Instrument)
+	}
+	ins, ok := cc.instruments[figi]
+	if !ok {
+		var err error
+		if ins, err = cc.ins.RequestByFigi(cc.ctx, figi); err != nil {
+			ins = schema.Instrument{Figi: figi}
+		}
+		cc.instruments[figi] = ins
 	}
+	return ins
+}
+
+func (cc *CandleCache) requestCandles(figi string, t1, t2 time.Time, interval string) ([]schema.Candle, error) {
+	fetch := func(t1, t2 time.Time) ([]schema.Candle, error) {
+		resp, err := cc.src.RequestCandles(cc.ctx, figi, t1, t2, interval)
+		return resp.Payload.Candles, err
+	}
+
+	var pcandles []schema.Candle
+	var err error
+	if cc.store == nil {
+		pcandles, err = fetch(t1, t2)
+	} else {
+		pcandles, err = cc.store.Candles(figi, interval, t1, t2, fetch)
+	}
+	if err != nil || cc.actions == nil && cc.bonds == nil {
+		return pcandles, err
+	}
+
+	// the stored candles are as the broker gives them, adjust a copy
+	adjusted := make([]schema.Candle, len(pcandles))
+	ins := cc.instrument(figi)
+	schedule := cc.bonds.Schedule(figi, ins.Isin)
+	for i, p := range pcandles {
+		date, err := time.Parse(time.RFC3339, p.Time)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse time: %v (%s)", p, err)
+		}
+		price := func(v float64) float64 {
+			return cc.actions.Price(figi, ins.Ticker, date, v) * schedule.Multiplier(date, ins.FaceValue)
+		}
+		p.O, p.H, p.L, p.C = price(p.O), price(p.H), price(p.L), price(p.C)
+		adjusted[i] = p
+	}
+	return adjusted, nil
 }
 
 func normalize(t time.Time) time.Time {
@@ -58,14 +143,20 @@ func normalize(t time.Time) time.Time {
 	return t
 }
 
-func (cc *CandleCache) fetchDay(figi string, t time.Time) (clist []candle) {
+func (cc *CandleCache) fetchDay(figi string, t time.Time) (clist []candle, err error) {
 	defer print(figi, clist)
 
 	for t1, t2 := t, t.Add(24*time.Hour); ; t1 = t1.Add(-24 * time.Hour) {
-		clist = cc.fetchDaily(figi, t1, t2)
+		clist, err = cc.fetchDaily(figi, t1, t2)
+		if err != nil {
+			return nil, err
+		}
 		if len(clist) > 0 {
 			break
 		}
+		if t1.Before(beginning) {
+			return nil, fmt.Errorf("no candles for %s before %s", figi, t)
+		}
 	}
 
 	// idx = first element after or equal to day @t
@@ -78,13 +169,13 @@ func (cc *CandleCache) fetchDay(figi string, t time.Time) (clist []candle) {
 	if idx < len(clist) {
 		el := clist[idx].time
 		if el.Year() == t.Year() && el.YearDay() == t.YearDay() {
-			return clist
+			return clist, nil
 		}
 	}
 
 	if idx == 0 {
 		// all candles are after
-		log.Fatalf("unexpected candle list: %s %v %s", figi, clist, t)
+		return nil, fmt.Errorf("unexpected candle list: %s %v %s", figi, clist, t)
 	}
 
 	clist = append(clist, candle{
@@ -92,13 +183,17 @@ func (cc *CandleCache) fetchDay(figi string, t time.Time) (clist []candle) {
 		price: clist[idx-1].price,
 	})
 
-	return clist
+	return clist, nil
 }
 
-func (cc *CandleCache) fetchDaily(figi string, t1, t2 time.Time) (clist []candle) {
+func (cc *CandleCache) fetchDaily(figi string, t1, t2 time.Time) (clist []candle, err error) {
 	t1 = normalize(t1)
 
-	pcandles := cc.client.RequestCandles(figi, t1, t2, "day").Payload.Candles
+	pcandles, err := cc.requestCandles(figi, t1, t2, "day")
+	if err != nil {
+		return nil, err
+	}
+
 	if len(pcandles) < 1 {
 		log.Debugf("No candles for period %s - %s", t1, t2)
 		return
@@ -111,7 +206,7 @@ func (cc *CandleCache) fetchDaily(figi string, t1, t2 time.Time) (clist []candle
 	for _, p := range pcandles {
 		date, err := time.Parse(time.RFC3339, p.Time)
 		if err != nil {
-			log.Fatalf("failed to parse time: %v (%s)", p, err)
+			return nil, fmt.Errorf("failed to parse time: %v (%s)", p, err)
 		}
 
 		clist = append(clist, candle{
@@ -120,7 +215,7 @@ func (cc *CandleCache) fetchDaily(figi string, t1, t2 time.Time) (clist []candle
 		})
 	}
 
-	return clist
+	return clist, nil
 }
 
 func print(figi string, clist []candle) {
@@ -168,30 +263,38 @@ func (cm candleMap) tryFind(figi string, t time.Time) (float64, error) {
 	return 0, errors.New("exact date not found")
 }
 
-func (cm candleMap) find(figi string, t time.Time) float64 {
-	price, err := cm.tryFind(figi, t)
-	if err != nil {
-		log.Fatalf("No candle %s %s: %s", figi, t, err)
-	}
-	return price
-}
-
-func (cc *CandleCache) Get(figi string, t time.Time) float64 {
+func (cc *CandleCache) TryGet(figi string, t time.Time) (float64, error) {
 	p, err := cc.getPeriodic(figi, t)
 	if err == nil {
-		return p
+		return p, nil
 	}
 
 	price, err := cc.cache.tryFind(figi, t)
 	if err == nil {
-		return price
+		return price, nil
 	}
 
-	pcandles := cc.fetchDay(figi, t)
+	pcandles, err := cc.fetchDay(figi, t)
+	if err != nil {
+		return 0, err
+	}
 
 	cc.cache[figi] = sortCandles(append(cc.cache[figi], pcandles...))
 
-	return cc.cache.find(figi, t)
+	return cc.cache.tryFind(figi, t)
+}
+
+// Get is fatal if there is no price, except for a cancelled context:
+// then 0 is returned and the caller is to drop whatever it computed with it
+func (cc *CandleCache) Get(figi string, t time.Time) float64 {
+	price, err := cc.TryGet(figi, t)
+	if err != nil {
+		if cc.ctx.Err() != nil {
+			return 0
+		}
+		log.Fatalf("No candle %s %s: %s", figi, t, err)
+	}
+	return price
 }
 
 func (cc *CandleCache) PriceFigi(t time.Time) schema.PriceFigi {
@@ -200,17 +303,45 @@ func (cc *CandleCache) PriceFigi(t time.Time) schema.PriceFigi {
 	}
 }
 
+// Xchgrate is fatal if there is no rate, like Get, and 0 for a cancelled context;
+// the callers that cannot drop what they computed with it use TryXchgrate first
 func (cc *CandleCache) Xchgrate(curr_from, curr_to string, t time.Time) float64 {
-	if xf, ok := map[string]func() float64{
-		"RUB" + "RUB": func() float64 { return 1 },
-		"RUB" + "USD": func() float64 { return 1 / cc.Get(schema.FigiUSD, t) },
-		"USD" + "USD": func() float64 { return 1 },
-		"USD" + "RUB": func() float64 { return cc.Get(schema.FigiUSD, t) },
-	}[curr_from+curr_to]; ok {
-		return xf()
-	}
-	log.Fatalf("unknown conversion %s->%s", curr_from, curr_to)
-	return 0
+	rate, err := cc.TryXchgrate(curr_from, curr_to, t)
+	if err != nil {
+		if cc.ctx.Err() != nil {
+			return 0
+		}
+		log.Fatalf("No rate %s->%s %s: %s", curr_from, curr_to, t, err)
+	}
+	return rate
+}
+
+// TryXchgrate goes through RUB; no candle is needed for the same currency
+func (cc *CandleCache) TryXchgrate(curr_from, curr_to string, t time.Time) (float64, error) {
+	if curr_from == curr_to {
+		return 1, nil
+	}
+	from, err := cc.rubRate(curr_from, t)
+	if err != nil {
+		return 0, err
+	}
+	to, err := cc.rubRate(curr_to, t)
+	if err != nil {
+		return 0, err
+	}
+	return from / to, nil
+}
+
+func (cc *CandleCache) rubRate(curr string, t time.Time) (float64, error) {
+	switch curr {
+	case "RUB":
+		return 1, nil
+	case "USD":
+		return cc.TryGet(schema.FigiUSD, t)
+	case "EUR":
+		return cc.TryGet(schema.FigiEUR, t)
+	}
+	return 0, fmt.Errorf("unknown conversion %s->RUB", curr)
 }
 
 func (cc *CandleCache) GetInCurrency(ins schema.Instrument, curr string, t time.Time) float64 {
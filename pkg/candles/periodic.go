@@ -2,6 +2,7 @@ package candles
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -32,12 +33,15 @@ func strToDuration(s string) time.Duration {
 	}
 }
 
-func (cc *CandleCache) doFetchPeriod(figi string, t1, t2 time.Time) (clist []candle) {
+func (cc *CandleCache) doFetchPeriod(figi string, t1, t2 time.Time) (clist []candle, err error) {
 	if cc.period == "day" {
 		return cc.fetchDaily(figi, t1, t2)
 	}
 
-	pcandles := cc.client.RequestCandles(figi, t1, t2, cc.period).Payload.Candles
+	pcandles, err := cc.requestCandles(figi, t1, t2, cc.period)
+	if err != nil {
+		return nil, err
+	}
 
 	if len(pcandles) < 1 {
 		log.Infof("No candles for period %s - %s (%s)", t1, t2, cc.start)
@@ -51,7 +55,7 @@ func (cc *CandleCache) doFetchPeriod(figi string, t1, t2 time.Time) (clist []can
 	for i := 1; i < len(pcandles); i++ {
 		date, err := time.Parse(time.RFC3339, pcandles[i].Time)
 		if err != nil {
-			log.Fatalf("failed to parse time: %v (%s)", pcandles[i], err)
+			return nil, fmt.Errorf("failed to parse time: %v (%s)", pcandles[i], err)
 		}
 
 		clist = append(clist, candle{
@@ -65,29 +69,37 @@ func (cc *CandleCache) doFetchPeriod(figi string, t1, t2 time.Time) (clist []can
 		price: pcandles[len(pcandles)-1].C,
 	})
 
-	return clist
+	return clist, nil
 }
 
-func (cc *CandleCache) fetchPeriod(figi string) {
+func (cc *CandleCache) fetchPeriod(figi string) error {
 	if _, exist := cc.pcache[figi]; exist {
-		return
+		return nil
 	}
 
 	pcandles := []candle{}
 	for now, t1 := time.Now(), cc.start.Add(-strToDuration(cc.period)); ; {
 		t2 := t1.Add(50 * strToDuration(cc.period))
 		if t2.After(now) {
-			pcandles = append(pcandles, cc.doFetchPeriod(figi, t1, now)...)
+			t2 = now
+		}
+
+		clist, err := cc.doFetchPeriod(figi, t1, t2)
+		if err != nil {
+			return err
+		}
+		pcandles = append(pcandles, clist...)
+
+		if t2 == now {
 			break
-		} else {
-			pcandles = append(pcandles, cc.doFetchPeriod(figi, t1, t2)...)
-			t1 = t2
 		}
+		t1 = t2
 	}
 
 	print(figi, pcandles)
 
 	cc.pcache[figi] = sortCandles(append(cc.pcache[figi], pcandles...))
+	return nil
 }
 
 func (cc *CandleCache) getPeriodic(figi string, t time.Time) (float64, error) {
@@ -95,7 +107,9 @@ func (cc *CandleCache) getPeriodic(figi string, t time.Time) (float64, error) {
 		return 0, errors.New("no period")
 	}
 
-	cc.fetchPeriod(figi)
+	if err := cc.fetchPeriod(figi); err != nil {
+		return 0, err
+	}
 
 	return cc.pcache.tryFind(figi, t)
 }
@@ -105,7 +119,12 @@ func (cc *CandleCache) ListTimes() (times []time.Time) {
 		log.Fatal("no cache period")
 	}
 
-	cc.fetchPeriod(schema.FigiUSD)
+	if err := cc.fetchPeriod(schema.FigiUSD); err != nil {
+		if cc.ctx.Err() != nil {
+			return nil
+		}
+		log.Fatal(err)
+	}
 	for _, c := range cc.pcache[schema.FigiUSD] {
 		times = append(times, c.time)
 	}
@@ -0,0 +1,277 @@
+package candles
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"../schema"
+)
+
+// Store keeps the downloaded candles on disk, one file per figi and interval:
+//   <dir>/<interval>/<figi>.json
+// Closed candles never change, so they are kept forever.
+// Only the spans that were not fetched yet, or are not closed yet (today), are requested again.
+
+type span struct {
+	From time.Time
+	To   time.Time
+}
+
+type storeEntry struct {
+	Candles []schema.Candle
+	Covered []span // sorted, not overlapping
+
+	path string
+}
+
+type Store struct {
+	dir     string
+	entries map[string]*storeEntry // key=path
+}
+
+type StoreStats struct {
+	Files   int
+	Bytes   int64
+	Candles map[string]int // key=interval
+}
+
+func DefaultStoreDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "tnkinv")
+}
+
+func NewStore(dir string) *Store {
+	return &Store{
+		dir:     dir,
+		entries: make(map[string]*storeEntry),
+	}
+}
+
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+func (s *Store) load(figi, interval string) *storeEntry {
+	path := filepath.Join(s.dir, interval, figi+".json")
+	if e, ok := s.entries[path]; ok {
+		return e
+	}
+
+	e := &storeEntry{path: path}
+	s.entries[path] = e
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("candle store: %s", err)
+		}
+		return e
+	}
+
+	if err = json.Unmarshal(data, e); err != nil {
+		log.Warnf("candle store: dropping broken %s: %s", path, err)
+		*e = storeEntry{path: path}
+	}
+	return e
+}
+
+func (e *storeEntry) save() {
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Warnf("candle store: %s", err)
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(e.path), 0755); err != nil {
+		log.Warnf("candle store: %s", err)
+		return
+	}
+
+	tmp := e.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		log.Warnf("candle store: %s", err)
+		return
+	}
+	if err = os.Rename(tmp, e.path); err != nil {
+		log.Warnf("candle store: %s", err)
+	}
+}
+
+// gaps returns the parts of [t1, t2) not covered yet
+func (e *storeEntry) gaps(t1, t2 time.Time) (gaps []span) {
+	for _, c := range e.Covered {
+		if !c.To.After(t1) {
+			continue
+		}
+		if !c.From.Before(t2) {
+			break
+		}
+		if c.From.After(t1) {
+			gaps = append(gaps, span{t1, c.From})
+		}
+		t1 = c.To
+	}
+	if t1.Before(t2) {
+		gaps = append(gaps, span{t1, t2})
+	}
+	return
+}
+
+func (e *storeEntry) cover(sp span) {
+	covered := append(e.Covered, sp)
+	sort.Slice(covered, func(i, j int) bool {
+		return covered[i].From.Before(covered[j].From)
+	})
+
+	e.Covered = covered[:1]
+	for _, c := range covered[1:] {
+		last := &e.Covered[len(e.Covered)-1]
+		if c.From.After(last.To) {
+			e.Covered = append(e.Covered, c)
+		} else if c.To.After(last.To) {
+			last.To = c.To
+		}
+	}
+}
+
+func (e *storeEntry) add(pcandles []schema.Candle) {
+	known := make(map[string]bool)
+	for _, p := range e.Candles {
+		known[p.Time] = true
+	}
+	for _, p := range pcandles {
+		if !known[p.Time] {
+			e.Candles = append(e.Candles, p)
+			known[p.Time] = true
+		}
+	}
+
+	sort.Slice(e.Candles, func(i, j int) bool {
+		return candleTime(e.Candles[i]).Before(candleTime(e.Candles[j]))
+	})
+}
+
+func candleTime(p schema.Candle) time.Time {
+	t, _ := time.Parse(time.RFC3339, p.Time)
+	return t
+}
+
+func candleEnd(start time.Time, interval string) time.Time {
+	switch interval {
+	case "week":
+		return start.AddDate(0, 0, 7)
+	case "month":
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// Candles returns the candles in [t1, t2), requesting only what is missing via fetch
+func (s *Store) Candles(figi, interval string, t1, t2 time.Time,
+	fetch func(t1, t2 time.Time) ([]schema.Candle, error)) ([]schema.Candle, error) {
+
+	e := s.load(figi, interval)
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	var open []schema.Candle
+	updated := false
+
+	for _, gap := range e.gaps(t1, t2) {
+		pcandles, err := fetch(gap.From, gap.To)
+		if err != nil {
+			return nil, err
+		}
+
+		// only closed candles are stored
+		closed := []schema.Candle{}
+		closedTill := gap.To
+		if closedTill.After(today) {
+			closedTill = today
+		}
+		for _, p := range pcandles {
+			if candleEnd(candleTime(p), interval).After(today) {
+				open = append(open, p)
+				if start := candleTime(p); start.Before(closedTill) {
+					closedTill = start
+				}
+			} else {
+				closed = append(closed, p)
+			}
+		}
+
+		e.add(closed)
+		if gap.From.Before(closedTill) {
+			e.cover(span{gap.From, closedTill})
+		}
+		updated = true
+	}
+
+	if updated {
+		e.save()
+	}
+
+	var res []schema.Candle
+	for _, p := range e.Candles {
+		if t := candleTime(p); !t.Before(t1) && t.Before(t2) {
+			res = append(res, p)
+		}
+	}
+	for _, p := range open {
+		if !e.has(p.Time) {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+func (e *storeEntry) has(t string) bool {
+	for _, p := range e.Candles {
+		if p.Time == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) Stats() (stats StoreStats, err error) {
+	stats.Candles = make(map[string]int)
+
+	err = filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+
+		stats.Files++
+		stats.Bytes += info.Size()
+
+		interval := filepath.Base(filepath.Dir(path))
+		figi := filepath.Base(path)
+		e := s.load(figi[:len(figi)-len(".json")], interval)
+		stats.Candles[interval] += len(e.Candles)
+		return nil
+	})
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
+
+func (s *Store) Clear() error {
+	s.entries = make(map[string]*storeEntry)
+	return os.RemoveAll(s.dir)
+}
@@ -0,0 +1,62 @@
+package candles
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"../schema"
+)
+
+func dailyCandles(t1, t2 time.Time) (pcandles []schema.Candle) {
+	for t := t1; t.Before(t2); t = t.AddDate(0, 0, 1) {
+		pcandles = append(pcandles, schema.Candle{
+			Time: t.Format(time.RFC3339),
+			C:    float64(t.Day()),
+		})
+	}
+	return
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "candles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var fetched []span
+	fetch := func(t1, t2 time.Time) ([]schema.Candle, error) {
+		fetched = append(fetched, span{t1, t2})
+		return dailyCandles(t1, t2), nil
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	t1, t2 := today.AddDate(0, 0, -20), today.AddDate(0, 0, -10)
+
+	pcandles, err := NewStore(dir).Candles("FIGI", "day", t1, t2, fetch)
+	if err != nil || len(pcandles) != 10 || len(fetched) != 1 {
+		t.Fatalf("got %d candles, %d fetches, err %v", len(pcandles), len(fetched), err)
+	}
+
+	// another run, bigger period: only the missing part is fetched
+	fetched = nil
+	pcandles, err = NewStore(dir).Candles("FIGI", "day", t1.AddDate(0, 0, -5), today.Add(time.Hour), fetch)
+	if err != nil || len(pcandles) != 26 {
+		t.Fatalf("got %d candles, err %v", len(pcandles), err)
+	}
+	if len(fetched) != 2 || !fetched[0].To.Equal(t1) || !fetched[1].From.Equal(t2) {
+		t.Errorf("fetched %v", fetched)
+	}
+
+	// today is not closed yet, so it is requested again
+	fetched = nil
+	if _, err = NewStore(dir).Candles("FIGI", "day", t1, today.Add(time.Hour), fetch); err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched) != 1 || !fetched[0].From.Equal(today) {
+		t.Errorf("fetched %v", fetched)
+	}
+}
@@ -0,0 +1,268 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"../schema"
+	"../source"
+)
+
+/* Catalog is the local copy of /market/stocks, /market/bonds, /market/etfs and /market/currencies.
+   Instruments are looked up there first, the rest is passed to the fallback source.
+   It is refreshed by `catalog sync` only: listings rarely change, and a stale entry
+   is still better than a request per instrument. */
+
+type Catalog struct {
+	source.Instruments
+
+	fname string
+
+	data struct {
+		Synced      time.Time
+		Instruments []schema.MarketInstrument
+	}
+
+	byFigi   map[string]int // index in data.Instruments
+	byTicker map[string]int
+}
+
+func DefaultFile(cacheDir string) string {
+	return filepath.Join(cacheDir, "catalog.json")
+}
+
+// Load reads the catalog, a missing file makes an empty one
+func Load(fname string, fallback source.Instruments) (*Catalog, error) {
+	c := &Catalog{
+		Instruments: fallback,
+		fname:       fname,
+	}
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err = json.Unmarshal(data, &c.data); err != nil {
+			return nil, fmt.Errorf("%s: %s", fname, err)
+		}
+	}
+
+	c.index()
+	return c, nil
+}
+
+func (c *Catalog) index() {
+	c.byFigi = make(map[string]int)
+	c.byTicker = make(map[string]int)
+	for i, mi := range c.data.Instruments {
+		c.byFigi[mi.Figi] = i
+		c.byTicker[strings.ToUpper(mi.Ticker)] = i
+	}
+}
+
+func (c *Catalog) Synced() time.Time {
+	return c.data.Synced
+}
+
+func (c *Catalog) Len() int {
+	return len(c.data.Instruments)
+}
+
+// Sync replaces the catalog with what src lists now and saves it
+func (c *Catalog) Sync(ctx context.Context, src source.Catalog) error {
+	instruments, err := src.RequestCatalog(ctx)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(instruments, func(i, j int) bool {
+		return instruments[i].Ticker < instruments[j].Ticker
+	})
+
+	c.data.Synced = time.Now()
+	c.data.Instruments = instruments
+	c.index()
+
+	return c.save()
+}
+
+func (c *Catalog) save() error {
+	data, err := json.MarshalIndent(c.data, "", " ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(c.fname), 0755); err != nil {
+		return err
+	}
+
+	tmp := c.fname + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.fname)
+}
+
+// =============================================================================
+
+func (c *Catalog) RequestByFigi(ctx context.Context, figi string) (schema.Instrument, error) {
+	if i, ok := c.byFigi[figi]; ok {
+		if ins, err := c.data.Instruments[i].Instrument(); err == nil {
+			return ins, nil
+		}
+	}
+	log.Debugf("catalog: no figi %s", figi)
+	return c.Instruments.RequestByFigi(ctx, figi)
+}
+
+func (c *Catalog) RequestByTicker(ctx context.Context, ticker string) (schema.Instrument, error) {
+	if i, ok := c.byTicker[strings.ToUpper(ticker)]; ok {
+		if ins, err := c.data.Instruments[i].Instrument(); err == nil {
+			return ins, nil
+		}
+	}
+	log.Debugf("catalog: no ticker %s", ticker)
+	return c.Instruments.RequestByTicker(ctx, ticker)
+}
+
+// =============================================================================
+
+// Search finds up to limit instruments by ticker, isin, figi or name, the best matches first.
+// Exact codes go first, then prefixes, substrings, and finally words with a typo or two.
+func (c *Catalog) Search(text string, limit int) []schema.MarketInstrument {
+	query := strings.ToLower(strings.TrimSpace(text))
+	if query == "" {
+		return nil
+	}
+
+	type match struct {
+		score int
+		idx   int
+	}
+	var matches []match
+
+	for i, mi := range c.data.Instruments {
+		if score, ok := matchScore(query, mi); ok {
+			matches = append(matches, match{score, i})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score < matches[j].score
+	})
+
+	var res []schema.MarketInstrument
+	for _, m := range matches {
+		if len(res) == limit {
+			break
+		}
+		res = append(res, c.data.Instruments[m.idx])
+	}
+	return res
+}
+
+// matchScore is lower for better matches
+func matchScore(query string, mi schema.MarketInstrument) (int, bool) {
+	ticker := strings.ToLower(mi.Ticker)
+	name := strings.ToLower(mi.Name)
+	codes := []string{ticker, strings.ToLower(mi.Isin), strings.ToLower(mi.Figi)}
+
+	for _, code := range codes {
+		if code == query {
+			return 0, true
+		}
+	}
+	if strings.HasPrefix(ticker, query) {
+		return 1, true
+	}
+	if strings.HasPrefix(name, query) {
+		return 2, true
+	}
+	for _, code := range codes {
+		if strings.Contains(code, query) {
+			return 3, true
+		}
+	}
+	if strings.Contains(name, query) {
+		return 4, true
+	}
+
+	// every word of the query is close to some word of the name or to the ticker
+	words := strings.Fields(strings.NewReplacer(",", " ", ".", " ", "\"", " ").Replace(name))
+	words = append(words, ticker)
+
+	total := 0
+	for _, qw := range strings.Fields(query) {
+		best := -1
+		for _, w := range words {
+			if d := distance(qw, w); d <= maxTypos(qw) && (best < 0 || d < best) {
+				best = d
+			}
+			if strings.HasPrefix(w, qw) {
+				best = 0
+			}
+		}
+		if best < 0 {
+			return 0, false
+		}
+		total += best
+	}
+	return 5 + total, true
+}
+
+func maxTypos(word string) int {
+	switch n := len([]rune(word)); {
+	case n < 3:
+		return 0
+	case n < 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// distance is the Levenshtein distance between a and b, with swapped neighbours counted as one typo
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	pprev := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if d := prev[j] + 1; d < cur[j] {
+				cur[j] = d
+			}
+			if d := cur[j-1] + 1; d < cur[j] {
+				cur[j] = d
+			}
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				if d := pprev[j-2] + 1; d < cur[j] {
+					cur[j] = d
+				}
+			}
+		}
+		pprev, prev, cur = prev, cur, pprev
+	}
+	return prev[len(rb)]
+}
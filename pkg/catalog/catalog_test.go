@@ -0,0 +1,99 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"../schema"
+)
+
+type fakeSource struct {
+	lookups int
+}
+
+func (s *fakeSource) RequestCatalog(ctx context.Context) ([]schema.MarketInstrument, error) {
+	return []schema.MarketInstrument{
+		{Figi: "BBG004730N88", Ticker: "SBER", Isin: "RU0009029540", Name: "Сбербанк России", Type: "Stock", Currency: "RUB", Lot: 10, MinPriceIncrement: 0.01},
+		{Figi: "BBG000B9XRY4", Ticker: "AAPL", Isin: "US0378331005", Name: "Apple", Type: "Stock", Currency: "USD", Lot: 1},
+		{Figi: "BBG00QPYJ5H0", Ticker: "FXIT", Isin: "IE00BD3QJ757", Name: "FinEx Акции компаний IT-сектора США", Type: "Etf", Currency: "RUB", Lot: 1},
+		{Figi: "BBG000BPB2D9", Ticker: "NESN", Name: "Nestle", Type: "Stock", Currency: "CHF", Lot: 1},
+	}, nil
+}
+
+func (s *fakeSource) RequestByFigi(ctx context.Context, figi string) (schema.Instrument, error) {
+	s.lookups++
+	return schema.Instrument{}, errors.New("not found")
+}
+
+func (s *fakeSource) RequestByTicker(ctx context.Context, ticker string) (schema.Instrument, error) {
+	s.lookups++
+	return schema.Instrument{}, errors.New("not found")
+}
+
+func TestCatalog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	src := &fakeSource{}
+	fname := filepath.Join(dir, "catalog.json")
+
+	c, err := Load(fname, src)
+	if err != nil || c.Len() != 0 {
+		t.Fatalf("empty catalog: %d %v", c.Len(), err)
+	}
+	if err = c.Sync(ctx, src); err != nil {
+		t.Fatal(err)
+	}
+
+	// another run reads it from disk
+	if c, err = Load(fname, src); err != nil || c.Len() != 4 {
+		t.Fatalf("saved catalog: %d %v", c.Len(), err)
+	}
+
+	ins, err := c.RequestByTicker(ctx, "sber")
+	if err != nil || ins.Figi != "BBG004730N88" || ins.Isin != "RU0009029540" || ins.Lot != 10 || ins.MinPriceIncrement != 0.01 {
+		t.Errorf("by ticker: %+v %v", ins, err)
+	}
+	if _, err = c.RequestByFigi(ctx, "BBG000B9XRY4"); err != nil || src.lookups != 0 {
+		t.Errorf("by figi: %v, %d lookups", err, src.lookups)
+	}
+
+	// unsupported currencies and unknown figis go to the fallback
+	c.RequestByFigi(ctx, "BBG000BPB2D9")
+	c.RequestByFigi(ctx, "UNKNOWN")
+	if src.lookups != 2 {
+		t.Errorf("%d lookups, exp 2", src.lookups)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	c, _ := Load(filepath.Join(os.TempDir(), "no-such-catalog.json"), &fakeSource{})
+	c.data.Instruments, _ = (&fakeSource{}).RequestCatalog(context.Background())
+	c.index()
+
+	for query, exp := range map[string]string{
+		"aapl":         "AAPL",
+		"US0378331005": "AAPL",
+		"сбер":         "SBER",
+		"appel":        "AAPL",
+		"it-сектора":   "FXIT",
+		"finex сша":    "FXIT",
+	} {
+		res := c.Search(query, 5)
+		if len(res) == 0 || res[0].Ticker != exp {
+			t.Errorf("search(%s) = %v, exp %s first", query, res, exp)
+		}
+	}
+
+	if res := c.Search("zzzzzz", 5); len(res) != 0 {
+		t.Errorf("search(zzzzzz) = %v", res)
+	}
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	swagger "../go-client"
+)
+
+// Error kinds. Use errors.Is(err, client.ErrNotFound) etc. to tell them apart.
+// Cancelled and timed out requests are ErrTransport wrapping the context error,
+// so errors.Is(err, context.Canceled) works as well.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrTransport    = errors.New("transport error")
+	ErrDecode       = errors.New("decode error")
+)
+
+type RequestError struct {
+	Op     string // e.g. "candles(BBG0013HGFT4)"
+	Kind   error  // one of Err* above
+	Status int    // http status, 0 if there was no response
+	Err    error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.Op, e.Kind, e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RequestError) Is(target error) bool {
+	return e.Kind == target
+}
+
+func newError(op string, kind error, err error) *RequestError {
+	return &RequestError{
+		Op:   op,
+		Kind: kind,
+		Err:  err,
+	}
+}
+
+// httpStatus extracts the status code out of the go-client error, which looks like "429 Too Many Requests"
+func httpStatus(err error) int {
+	var swErr swagger.GenericSwaggerError
+	if !errors.As(err, &swErr) {
+		return 0
+	}
+
+	code, convErr := strconv.Atoi(strings.SplitN(swErr.Error(), " ", 2)[0])
+	if convErr != nil {
+		return 0
+	}
+	return code
+}
+
+// requestError classifies an error returned by the go-client
+func requestError(op string, err error) *RequestError {
+	status := httpStatus(err)
+
+	kind := ErrTransport
+	switch {
+	case status == 429:
+		kind = ErrRateLimited
+	case status == 401 || status == 403:
+		kind = ErrUnauthorized
+	case status == 404:
+		kind = ErrNotFound
+	case status != 0:
+		// the API reports unknown figis and tickers as 500 with a message
+		var swErr swagger.GenericSwaggerError
+		if errors.As(err, &swErr) && strings.Contains(strings.ToLower(string(swErr.Body())), "not found") {
+			kind = ErrNotFound
+		}
+	}
+
+	rerr := newError(op, kind, err)
+	rerr.Status = status
+	return rerr
+}
+
+func decodeError(op string, err error) *RequestError {
+	return newError(op, ErrDecode, err)
+}
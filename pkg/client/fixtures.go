@@ -0,0 +1,216 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Fixtures are the recorded OpenAPI requests, one json file per request,
+// so that show/story/deals can be rerun without network.
+
+type fixture struct {
+	Method   string
+	URL      string
+	Recorded time.Time
+	Status   int
+	Body     string
+
+	path  string
+	query url.Values
+}
+
+// timestamps derived from time.Now() differ between runs,
+// they match if they are this close relative to the time of the run
+const nowTolerance = 15 * time.Minute
+
+func fixtureKey(method string, u *url.URL) string {
+	// the host is not a part of the key so one can replay against any base path
+	return method + " " + u.Path + "?" + u.Query().Encode()
+}
+
+func fixtureName(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:10]) + ".json"
+}
+
+// =============================================================================
+
+type recorder struct {
+	dir  string
+	base http.RoundTripper
+}
+
+func newRecorder(dir string, base http.RoundTripper) (*recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &recorder{
+		dir:  dir,
+		base: base,
+	}, nil
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	fx := fixture{
+		Method:   req.Method,
+		URL:      req.URL.String(),
+		Recorded: time.Now(),
+		Status:   resp.StatusCode,
+		Body:     string(body),
+	}
+
+	data, err := json.MarshalIndent(fx, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(r.dir, fixtureName(fixtureKey(req.Method, req.URL))), data, 0644)
+	}
+	if err != nil {
+		log.Warnf("failed to record %s: %s", req.URL, err)
+	}
+
+	return resp, nil
+}
+
+// =============================================================================
+
+type replayer struct {
+	mu       sync.Mutex
+	fixtures map[string]*fixture // key=fixtureKey
+	now      func() time.Time
+}
+
+func newReplayer(dir string) (*replayer, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no fixtures in %s", dir)
+	}
+
+	r := &replayer{
+		fixtures: make(map[string]*fixture),
+		now:      time.Now,
+	}
+
+	for _, fname := range files {
+		data, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return nil, err
+		}
+
+		fx := &fixture{}
+		if err = json.Unmarshal(data, fx); err != nil {
+			return nil, fmt.Errorf("%s: %s", fname, err)
+		}
+
+		u, err := url.Parse(fx.URL)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", fname, err)
+		}
+		fx.path = u.Path
+		fx.query = u.Query()
+
+		r.fixtures[fixtureKey(fx.Method, u)] = fx
+	}
+
+	log.Debugf("loaded %d fixtures from %s", len(r.fixtures), dir)
+	return r, nil
+}
+
+// nowMatch tells if two timestamps are the same moment relative to the time they were taken at
+func nowMatch(recorded, requested string, recordedAt, now time.Time) (time.Duration, bool) {
+	t1, err1 := time.Parse(time.RFC3339, recorded)
+	t2, err2 := time.Parse(time.RFC3339, requested)
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+
+	diff := t1.Sub(recordedAt) - t2.Sub(now)
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff, diff < nowTolerance
+}
+
+func (r *replayer) find(req *http.Request) *fixture {
+	if fx, ok := r.fixtures[fixtureKey(req.Method, req.URL)]; ok {
+		return fx
+	}
+
+	query := req.URL.Query()
+	now := r.now()
+
+	var best *fixture
+	var bestDiff time.Duration
+
+next:
+	for _, fx := range r.fixtures {
+		if fx.Method != req.Method || fx.path != req.URL.Path || len(fx.query) != len(query) {
+			continue
+		}
+
+		var total time.Duration
+		for name := range query {
+			rec, req := fx.query.Get(name), query.Get(name)
+			if rec == req {
+				continue
+			}
+			diff, ok := nowMatch(rec, req, fx.Recorded, now)
+			if !ok {
+				continue next
+			}
+			total += diff
+		}
+
+		if best == nil || total < bestDiff {
+			best, bestDiff = fx, total
+		}
+	}
+
+	return best
+}
+
+func (r *replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	fx := r.find(req)
+	r.mu.Unlock()
+
+	if fx == nil {
+		return nil, fmt.Errorf("no fixture for %s %s", req.Method, req.URL)
+	}
+
+	log.Tracef("replaying %s for %s", fx.URL, req.URL)
+
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", fx.Status, http.StatusText(fx.Status)),
+		StatusCode: fx.Status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(fx.Body)),
+		Request:    req,
+	}, nil
+}
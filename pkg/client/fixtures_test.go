@@ -0,0 +1,77 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, rt http.RoundTripper, u string) string {
+	resp, err := (&http.Client{Transport: rt}).Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"figi":"` + r.URL.Query().Get("figi") + `"}`))
+	}))
+
+	rec, err := newRecorder(dir, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	opsURL := func(now time.Time) string {
+		return "/operations?" + url.Values{
+			"from": {"2019-01-01T00:00:00Z"},
+			"to":   {now.Format(time.RFC3339)},
+		}.Encode()
+	}
+
+	get(t, rec, srv.URL+"/market/search/by-figi?figi=F1")
+	get(t, rec, srv.URL+opsURL(now))
+	srv.Close()
+
+	rep, err := newReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep.now = func() time.Time {
+		return now.Add(48 * time.Hour)
+	}
+
+	// any host will do
+	if body := get(t, rep, "http://localhost/market/search/by-figi?figi=F1"); body != `{"figi":"F1"}` {
+		t.Errorf("replayed %s", body)
+	}
+
+	// "now" two days later is still the same request
+	get(t, rep, "http://localhost"+opsURL(now.Add(48*time.Hour)))
+
+	if _, err := (&http.Client{Transport: rep}).Get("http://localhost/market/search/by-figi?figi=F2"); err == nil {
+		t.Errorf("replayed unknown request")
+	}
+	if _, err := (&http.Client{Transport: rep}).Get("http://localhost" + opsURL(now.Add(24*time.Hour))); err == nil {
+		t.Errorf("replayed a request for another date")
+	}
+}
@@ -1,9 +1,12 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"net/http"
 	"strings"
 	"time"
 
@@ -11,17 +14,82 @@ import (
 
 	swagger "../go-client"
 	"../schema"
+	"../source"
 )
 
 type MyClient struct {
-	swc    *swagger.APIClient
-	tokenf string
+	swc       *swagger.APIClient
+	tokenf    string
+	transport *transport
+
+	// what the go-client talks to: the transport, maybe wrapped by recorder, or the replayer
+	roundTripper http.RoundTripper
+	offline      bool
+
+	basePath string
 }
 
+var _ source.Source = (*MyClient)(nil)
+var _ source.Catalog = (*MyClient)(nil)
+var _ source.Orderbooks = (*MyClient)(nil)
+
+const DefaultBasePath = "https://api-invest.tinkoff.ru/openapi/"
+
 func NewClient(tokenf string) *MyClient {
+	t := newTransport(http.DefaultTransport)
 	return &MyClient{
-		tokenf: tokenf,
+		tokenf:       tokenf,
+		transport:    t,
+		roundTripper: t,
+		basePath:     DefaultBasePath,
+	}
+}
+
+// WithTimeout limits every attempt to send a request to d;
+// quota waits and retries are not counted, use the context for the total
+func (c *MyClient) WithTimeout(d time.Duration) *MyClient {
+	c.transport.timeout = d
+	return c
+}
+
+// WithBasePath points the client to another server, e.g. the emulator
+func (c *MyClient) WithBasePath(path string) *MyClient {
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	c.basePath = path
+	return c
+}
+
+// WithRecording saves every request and response to dir
+func (c *MyClient) WithRecording(dir string) (*MyClient, error) {
+	r, err := newRecorder(dir, c.roundTripper)
+	if err != nil {
+		return nil, err
+	}
+	c.roundTripper = r
+	return c, nil
+}
+
+// WithReplay serves the requests from the fixtures recorded to dir, no network is used
+func (c *MyClient) WithReplay(dir string) (*MyClient, error) {
+	r, err := newReplayer(dir)
+	if err != nil {
+		return nil, err
 	}
+	c.roundTripper = r
+	c.offline = true
+	return c, nil
+}
+
+func (c *MyClient) newConfiguration(basePath, token string) *swagger.Configuration {
+	conf := swagger.NewConfiguration()
+	conf.BasePath = basePath
+	conf.AddDefaultHeader("Authorization", "Bearer "+token)
+	conf.HTTPClient = &http.Client{
+		Transport: c.roundTripper,
+	}
+	return conf
 }
 
 type optional struct {
@@ -36,222 +104,240 @@ func (o optional) Value() interface{} {
 	return o.value
 }
 
-func (c *MyClient) getToken(fname string) string {
+func (c *MyClient) getToken(fname string) (string, error) {
+	if c.offline || fname == "" {
+		return "", nil
+	}
+
 	b, err := ioutil.ReadFile(fname)
 	if err != nil {
-		log.Fatal(err)
+		return "", newError("token", ErrUnauthorized, err)
 	}
 
-	return string(b)
+	return string(b), nil
 }
 
-func (c *MyClient) TrySandbox() error {
-	conf := swagger.NewConfiguration()
-	conf.BasePath = "https://api-invest.tinkoff.ru/openapi/sandbox/"
-	conf.AddDefaultHeader("Authorization", "Bearer "+c.getToken(c.tokenf))
+func (c *MyClient) TrySandbox(ctx context.Context) error {
+	token, err := c.getToken(c.tokenf)
+	if err != nil {
+		return err
+	}
 
-	swc := swagger.NewAPIClient(conf)
+	swc := swagger.NewAPIClient(
+		c.newConfiguration(c.basePath+"sandbox/", token))
 
 	sand := swc.SandboxApi
 
-	_, err := sand.SandboxRegisterPost(nil)
+	_, err = sand.SandboxRegisterPost(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return requestError("sandbox register", err)
 	}
 
 	log.Info("sandbox register complete")
 	return nil
 }
 
-func (c *MyClient) getAPI() *swagger.APIClient {
+func (c *MyClient) getAPI() (*swagger.APIClient, error) {
 	if c.swc == nil {
-		conf := swagger.NewConfiguration()
-		conf.BasePath = "https://api-invest.tinkoff.ru/openapi/"
-		conf.AddDefaultHeader("Authorization", "Bearer "+c.getToken(c.tokenf))
+		token, err := c.getToken(c.tokenf)
+		if err != nil {
+			return nil, err
+		}
 
-		c.swc = swagger.NewAPIClient(conf)
+		c.swc = swagger.NewAPIClient(
+			c.newConfiguration(c.basePath, token))
 	}
-	return c.swc
+	return c.swc, nil
 }
 
-func (c *MyClient) RequestCurrentPrice(figi string) float64 {
-	mktApi := c.getAPI().MarketApi
-	mktResp := schema.OrderbookResponse{}
+// request performs the call and decodes the response body into resp
+func (c *MyClient) request(ctx context.Context, op string, resp interface{},
+	call func(context.Context, *swagger.APIClient) ([]byte, error)) error {
 
-	body, err := mktApi.MarketOrderbookGet(nil, figi, 1)
+	api, err := c.getAPI()
 	if err != nil {
-		log.Fatalf("price(%s): %s", figi, err)
+		return err
 	}
 
-	err = json.Unmarshal(body, &mktResp)
+	body, err := call(ctx, api)
 	if err != nil {
-		log.Fatalf("price(%s): %s", figi, err)
+		return requestError(op, err)
 	}
 
 	log.Trace(string(body))
 
-	return mktResp.Payload.LastPrice
-}
-
-func (c *MyClient) RequestByFigi(figi string) schema.Instrument {
-	mktApi := c.getAPI().MarketApi
-	resp := schema.SearchByFigiResponse{}
-
-	body, err := mktApi.MarketSearchByFigiGet(nil, figi)
+	err = json.Unmarshal(body, resp)
 	if err != nil {
-		log.Fatalf("by figi(%s): %s", figi, err)
+		return decodeError(op, err)
 	}
 
-	err = json.Unmarshal(body, &resp)
+	return nil
+}
+
+func (c *MyClient) RequestCurrentPrice(ctx context.Context, figi string) (float64, error) {
+	mktResp, err := c.RequestOrderbook(ctx, figi)
 	if err != nil {
-		log.Fatalf("by figi(%s): %s", figi, err)
+		return 0, err
 	}
 
-	log.Trace(string(body))
+	return mktResp.Payload.LastPrice, nil
+}
+
+// RequestOrderbook returns the best bid and ask only
+func (c *MyClient) RequestOrderbook(ctx context.Context, figi string) (schema.OrderbookResponse, error) {
+	mktResp := schema.OrderbookResponse{}
 
-	return schema.NewInstrument(
-		resp.Payload.Figi,
-		resp.Payload.Ticker,
-		resp.Payload.Name,
-		resp.Payload.Type,
-		resp.Payload.Currency,
-		resp.Payload.FaceValue,
-		resp.Payload.Lot)
+	err := c.request(ctx, fmt.Sprintf("orderbook(%s)", figi), &mktResp, func(ctx context.Context, api *swagger.APIClient) ([]byte, error) {
+		return api.MarketApi.MarketOrderbookGet(ctx, figi, 1)
+	})
+	return mktResp, err
 }
 
-func (c *MyClient) TryRequestByTicker(ticker string) (schema.Instrument, error) {
-	mktApi := c.getAPI().MarketApi
-	resp := schema.SearchByTickerResponse{}
+func (c *MyClient) RequestByFigi(ctx context.Context, figi string) (schema.Instrument, error) {
+	resp := schema.SearchByFigiResponse{}
 
-	body, err := mktApi.MarketSearchByTickerGet(nil, ticker)
+	err := c.request(ctx, fmt.Sprintf("by figi(%s)", figi), &resp, func(ctx context.Context, api *swagger.APIClient) ([]byte, error) {
+		return api.MarketApi.MarketSearchByFigiGet(ctx, figi)
+	})
 	if err != nil {
-		log.Fatalf("by ticker(%s): %s", ticker, err)
+		return schema.Instrument{}, err
+	}
+
+	if resp.Payload.Figi == "" {
+		return schema.Instrument{}, newError(fmt.Sprintf("by figi(%s)", figi), ErrNotFound, errors.New("empty payload"))
 	}
 
-	err = json.Unmarshal(body, &resp)
+	return resp.Payload.Instrument()
+}
+
+func (c *MyClient) RequestByTicker(ctx context.Context, ticker string) (schema.Instrument, error) {
+	resp := schema.SearchByTickerResponse{}
+
+	err := c.request(ctx, fmt.Sprintf("by ticker(%s)", ticker), &resp, func(ctx context.Context, api *swagger.APIClient) ([]byte, error) {
+		return api.MarketApi.MarketSearchByTickerGet(ctx, ticker)
+	})
 	if err != nil {
-		log.Fatalf("by ticker(%s): %s", ticker, err)
+		return schema.Instrument{}, err
 	}
 
 	if len(resp.Payload.Instruments) == 0 {
-		return schema.Instrument{}, errors.New("ticker not found")
+		return schema.Instrument{}, newError(fmt.Sprintf("by ticker(%s)", ticker), ErrNotFound, errors.New("ticker not found"))
 	}
 
-	log.Trace(string(body))
-
-	i := resp.Payload.Instruments[0]
-
-	return schema.NewInstrument(
-		i.Figi,
-		i.Ticker,
-		i.Name,
-		i.Type,
-		i.Currency,
-		i.FaceValue, i.Lot), nil
+	return resp.Payload.Instruments[0].Instrument()
 }
 
-func (c *MyClient) RequestByTicker(ticker string) schema.Instrument {
-	i, err := c.TryRequestByTicker(ticker)
-	if err != nil {
-		log.Fatal(err)
+// RequestCatalog lists all the stocks, bonds, etfs and currencies
+func (c *MyClient) RequestCatalog(ctx context.Context) ([]schema.MarketInstrument, error) {
+	var all []schema.MarketInstrument
+
+	lists := []struct {
+		op  string
+		get func(context.Context, *swagger.APIClient) ([]byte, error)
+	}{
+		{"stocks", func(ctx context.Context, api *swagger.APIClient) ([]byte, error) {
+			return api.MarketApi.MarketStocksGet(ctx)
+		}},
+		{"bonds", func(ctx context.Context, api *swagger.APIClient) ([]byte, error) {
+			return api.MarketApi.MarketBondsGet(ctx)
+		}},
+		{"etfs", func(ctx context.Context, api *swagger.APIClient) ([]byte, error) {
+			return api.MarketApi.MarketEtfsGet(ctx)
+		}},
+		{"currencies", func(ctx context.Context, api *swagger.APIClient) ([]byte, error) {
+			return api.MarketApi.MarketCurrenciesGet(ctx)
+		}},
+	}
+
+	for _, list := range lists {
+		resp := schema.SearchByTickerResponse{}
+		if err := c.request(ctx, list.op, &resp, list.get); err != nil {
+			return nil, err
+		}
+		all = append(all, resp.Payload.Instruments...)
 	}
-	return i
+
+	return all, nil
 }
 
-func (c *MyClient) RequestPortfolio(acc string) schema.PortfolioResponse {
-	pfApi := c.getAPI().PortfolioApi
+func (c *MyClient) RequestPortfolio(ctx context.Context, acc string) (schema.PortfolioResponse, error) {
 	pfResp := schema.PortfolioResponse{}
 	opts := &swagger.PortfolioGetOpts{
 		BrokerAccountId: optional{acc},
 	}
 
-	body, err := pfApi.PortfolioGet(nil, opts)
-	if err != nil {
-		log.Fatal(err)
-	}
+	err := c.request(ctx, fmt.Sprintf("portfolio(%s)", acc), &pfResp, func(ctx context.Context, api *swagger.APIClient) ([]byte, error) {
+		return api.PortfolioApi.PortfolioGet(ctx, opts)
+	})
 
-	err = json.Unmarshal(body, &pfResp)
-	if err != nil {
-		log.Fatal(err)
+	return pfResp, err
+}
+
+func (c *MyClient) RequestCurrencies(ctx context.Context, acc string) (schema.CurrenciesResponse, error) {
+	curResp := schema.CurrenciesResponse{}
+	opts := &swagger.PortfolioCurrenciesGetOpts{
+		BrokerAccountId: optional{acc},
 	}
 
-	log.Trace(string(body))
+	err := c.request(ctx, fmt.Sprintf("currencies(%s)", acc), &curResp, func(ctx context.Context, api *swagger.APIClient) ([]byte, error) {
+		return api.PortfolioApi.PortfolioCurrenciesGet(ctx, opts)
+	})
 
-	return pfResp
+	return curResp, err
 }
 
-func (c *MyClient) RequestOperations(start time.Time, acc string) schema.OperationsResponse {
+func (c *MyClient) RequestOperations(ctx context.Context, start time.Time, acc string) (schema.OperationsResponse, error) {
 	timeStartStr := start.Format(time.RFC3339)
 	timeNow := time.Now()
 
-	opsApi := c.getAPI().OperationsApi
 	opsResp := schema.OperationsResponse{}
 	opts := &swagger.OperationsGetOpts{
 		Figi:            optional{},
 		BrokerAccountId: optional{acc},
 	}
 
-	body, err := opsApi.OperationsGet(nil, timeStartStr, timeNow.Format(time.RFC3339), opts)
-	if err != nil {
-		log.Fatal(err)
-	}
+	err := c.request(ctx, fmt.Sprintf("operations(%s, %s)", acc, timeStartStr), &opsResp, func(ctx context.Context, api *swagger.APIClient) ([]byte, error) {
+		return api.OperationsApi.OperationsGet(ctx, timeStartStr, timeNow.Format(time.RFC3339), opts)
+	})
 
-	err = json.Unmarshal(body, &opsResp)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	log.Trace(string(body))
-
-	return opsResp
+	return opsResp, err
 }
 
-func (c *MyClient) RequestCandles(figi string, t1, t2 time.Time, interval string) schema.CandlesResponse {
+func (c *MyClient) RequestCandles(ctx context.Context, figi string, t1, t2 time.Time, interval string) (schema.CandlesResponse, error) {
 	t1Str := t1.Format(time.RFC3339)
 	t2Str := t2.Format(time.RFC3339)
 
-	mktApi := c.getAPI().MarketApi
 	mktResp := schema.CandlesResponse{}
 
-again:
-	body, err := mktApi.MarketCandlesGet(nil, figi, t1Str, t2Str, interval)
-	if err != nil {
-		if strings.HasPrefix(err.Error(), "429 ") {
-			log.Infof("429. calming down")
-			time.Sleep(30 * time.Second)
-			goto again
-		}
-		log.Fatalf("candles(%s, %s : %s : %s): %s", figi, t1, interval, t2, err)
-	}
+	err := c.request(ctx, fmt.Sprintf("candles(%s, %s : %s : %s)", figi, t1, interval, t2), &mktResp, func(ctx context.Context, api *swagger.APIClient) ([]byte, error) {
+		return api.MarketApi.MarketCandlesGet(ctx, figi, t1Str, t2Str, interval)
+	})
 
-	err = json.Unmarshal(body, &mktResp)
-	if err != nil {
-		log.Fatalf("candles(%s, %s): %s", figi, t1, err)
-	}
-
-	log.Trace(string(body))
-
-	return mktResp
+	return mktResp, err
 }
 
-func (c *MyClient) RequestAccounts() schema.AccountsResponse {
-	userApi := c.getAPI().UserApi
+func (c *MyClient) RequestAccounts(ctx context.Context) (schema.AccountsResponse, error) {
 	accResp := schema.AccountsResponse{}
 
-	body, err := userApi.UserAccountsGet(nil)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	err = json.Unmarshal(body, &accResp)
-	if err != nil {
-		log.Fatal(err)
-	}
+	err := c.request(ctx, "accounts", &accResp, func(ctx context.Context, api *swagger.APIClient) ([]byte, error) {
+		return api.UserApi.UserAccountsGet(ctx)
+	})
 
-	log.Trace(string(body))
+	return accResp, err
+}
 
-	return accResp
+// Stats reports how much the requests were throttled so far
+func (c *MyClient) Stats() TransportStats {
+	return c.transport.Stats()
 }
 
 func (c *MyClient) Stop() {
+	stats := c.Stats()
+
+	logf := log.Debugf
+	if stats.Throttled > 0 || stats.Retries > 0 {
+		logf = log.Infof
+	}
+	logf("%d requests, throttled %d times, retried %d times, waited %s",
+		stats.Requests, stats.Throttled, stats.Retries, stats.Waited.Round(time.Second))
 }
@@ -0,0 +1,252 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Requests per minute, see https://tinkoffcreditsystems.github.io/invest-openapi/rest/
+var quotas = map[string]int{
+	"market":     240,
+	"orders":     100,
+	"portfolio":  120,
+	"operations": 120,
+	"sandbox":    120,
+	"user":       120,
+}
+
+const defaultQuota = 120
+
+type TransportStats struct {
+	Requests  int           // round trips to the server, including retries
+	Throttled int           // times a request waited for the local limiter
+	Retries   int           // times a request was resent after 429 or 5xx
+	Waited    time.Duration // total time spent waiting
+}
+
+// window keeps the start times of the requests made during the last minute
+type window struct {
+	quota int
+	times []time.Time
+}
+
+// transport is an http.RoundTripper that keeps every endpoint group within its quota
+// and retries the requests that failed with 429 or 5xx
+type transport struct {
+	base http.RoundTripper
+
+	maxRetries int
+	retryBase  time.Duration
+	retryMax   time.Duration
+	timeout    time.Duration // per attempt, 0 for none
+
+	mu      sync.Mutex
+	windows map[string]*window
+	stats   TransportStats
+
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func newTransport(base http.RoundTripper) *transport {
+	return &transport{
+		base:       base,
+		maxRetries: 6,
+		retryBase:  time.Second,
+		retryMax:   time.Minute,
+		windows:    make(map[string]*window),
+		sleep:      sleep,
+	}
+}
+
+// sleep waits for d unless ctx is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// group returns the endpoint group of the request, e.g. "market" for .../openapi/market/candles
+func group(path string) string {
+	for _, part := range strings.Split(path, "/") {
+		if _, ok := quotas[part]; ok {
+			return part
+		}
+	}
+	return ""
+}
+
+func (t *transport) wait(ctx context.Context, grp string) error {
+	// no quota for the requests that are not going to be sent
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+
+	w := t.windows[grp]
+	if w == nil {
+		quota, ok := quotas[grp]
+		if !ok {
+			quota = defaultQuota
+		}
+		w = &window{quota: quota}
+		t.windows[grp] = w
+	}
+
+	now := time.Now()
+
+	// drop the requests older than a minute
+	idx := 0
+	for idx < len(w.times) && now.Sub(w.times[idx]) >= time.Minute {
+		idx++
+	}
+	w.times = w.times[idx:]
+
+	var delay time.Duration
+	if len(w.times) >= w.quota {
+		delay = w.times[len(w.times)-w.quota].Add(time.Minute).Sub(now)
+		t.stats.Throttled++
+		t.stats.Waited += delay
+	}
+	w.times = append(w.times, now.Add(delay))
+
+	t.mu.Unlock()
+
+	if delay > 0 {
+		log.Debugf("%s quota exhausted, waiting %s", grp, delay)
+		return t.sleep(ctx, delay)
+	}
+	return nil
+}
+
+// backoff is exponential with equal jitter: half of the delay is kept, the other half is random;
+// it is never shorter than what the server asked for
+func (t *transport) backoff(attempt int, resp *http.Response) time.Duration {
+	d := t.retryBase << uint(attempt)
+	if d > t.retryMax || d <= 0 {
+		d = t.retryMax
+	}
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+
+	if resp != nil {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			if ra := time.Duration(secs) * time.Second; ra > d {
+				d = ra
+			}
+		}
+	}
+	return d
+}
+
+// retriable tells if the request may succeed when resent
+func retriable(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if resp.StatusCode < 500 {
+		return false
+	}
+
+	// unknown instruments are reported as 500, no point in asking again
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return true
+	}
+	return !strings.Contains(strings.ToLower(string(body)), "not found")
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	grp := group(req.URL.Path)
+
+	for attempt := 0; ; attempt++ {
+		if err := t.wait(req.Context(), grp); err != nil {
+			return nil, err
+		}
+
+		t.mu.Lock()
+		t.stats.Requests++
+		t.mu.Unlock()
+
+		resp, err := t.roundTrip(req)
+		if err != nil || !retriable(resp) || attempt == t.maxRetries {
+			return resp, err
+		}
+
+		if req.Body != nil {
+			if req.GetBody == nil {
+				return resp, err
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				// the failed response is the answer then
+				log.Warnf("%s: %s, cannot resend: %s", req.URL.Path, resp.Status, bodyErr)
+				return resp, nil
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		delay := t.backoff(attempt, resp)
+		resp.Body.Close()
+
+		t.mu.Lock()
+		t.stats.Retries++
+		t.stats.Waited += delay
+		t.mu.Unlock()
+
+		log.Infof("%s: %s, retrying in %s", req.URL.Path, resp.Status, delay.Round(time.Millisecond))
+		if err := t.sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// roundTrip makes a single attempt, limited by the timeout till the body is closed
+func (t *transport) roundTrip(req *http.Request) (*http.Response, error) {
+	if t.timeout == 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{resp.Body, cancel}
+	return resp, nil
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+func (t *transport) Stats() TransportStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats
+}
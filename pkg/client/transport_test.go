@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestTransport() (*transport, *time.Duration) {
+	slept := new(time.Duration)
+	t := newTransport(http.DefaultTransport)
+	t.retryBase = time.Millisecond
+	t.sleep = func(ctx context.Context, d time.Duration) error {
+		*slept += d
+		return nil
+	}
+	return t, slept
+}
+
+func TestGroup(t *testing.T) {
+	for path, exp := range map[string]string{
+		"/openapi//market/candles":   "market",
+		"/openapi/sandbox//user/acc": "sandbox",
+		"/openapi//portfolio":        "portfolio",
+		"/whatever":                  "",
+	} {
+		if grp := group(path); grp != exp {
+			t.Errorf("group(%s) = %s, exp %s", path, grp, exp)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls <= 2 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	tr, _ := newTestTransport()
+	resp, err := (&http.Client{Transport: tr}).Get(srv.URL + "/market/candles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, exp 200", resp.StatusCode)
+	}
+	if stats := tr.Stats(); stats.Retries != 2 || stats.Requests != 3 {
+		t.Errorf("stats = %+v, exp 2 retries of 3 requests", stats)
+	}
+}
+
+func TestNoRetryNotFound(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"payload":{"message":"Instrument not found"}}`))
+	}))
+	defer srv.Close()
+
+	tr, _ := newTestTransport()
+	resp, err := (&http.Client{Transport: tr}).Get(srv.URL + "/market/search/by-figi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if calls != 1 {
+		t.Errorf("calls = %d, exp 1", calls)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	tr, slept := newTestTransport()
+	c := &http.Client{Transport: tr}
+
+	for i := 0; i < quotas["user"]+1; i++ {
+		resp, err := c.Get(srv.URL + "/user/accounts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if stats := tr.Stats(); stats.Throttled != 1 || *slept < 59*time.Second {
+		t.Errorf("stats = %+v, slept %s, exp 1 throttle for about a minute", stats, *slept)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	tr, _ := newTestTransport()
+	tr.timeout = 10 * time.Millisecond
+
+	if _, err := (&http.Client{Transport: tr}).Get(srv.URL + "/market/candles"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, exp deadline exceeded", err)
+	}
+}
+
+func TestCancelRetry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	tr := newTransport(http.DefaultTransport)
+	tr.retryBase = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/market/candles", nil)
+	if _, err := (&http.Client{Transport: tr}).Do(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, exp canceled", err)
+	}
+}
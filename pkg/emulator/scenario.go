@@ -0,0 +1,167 @@
+package emulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"../schema"
+)
+
+/* Scenario describes the world the emulator serves:
+
+{
+  "accounts": [{"id": "2000000001", "type": "Tinkoff"}, {"id": "2000000002", "type": "TinkoffIis"}],
+  "instruments": [
+    {"figi": "BBG004730N88", "ticker": "SBER", "name": "Сбербанк", "type": "Stock", "currency": "RUB", "lot": 10,
+     "prices": [{"date": "2020/01/10", "price": 250}, {"date": "2020/06/10", "price": 200}]}
+  ],
+  "operations": [
+    {"account": "2000000001", "operationType": "PayIn", "status": "Done", "currency": "RUB", "payment": 10000,
+     "date": "2020-01-10T10:00:00+03:00"},
+    ...
+  ]
+}
+
+Operations are in the OpenAPI format (same as --operations files) plus the account id;
+the empty account id is the default broker account.
+Prices are stepwise: the price holds until the next point.
+*/
+
+type Account struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+type PricePoint struct {
+	Date  string  `json:"date"`
+	Price float64 `json:"price"`
+
+	date time.Time
+}
+
+type Instrument struct {
+	Figi              string       `json:"figi"`
+	Ticker            string       `json:"ticker"`
+	Isin              string       `json:"isin"`
+	Name              string       `json:"name"`
+	Type              string       `json:"type"`
+	Currency          string       `json:"currency"`
+	Lot               int          `json:"lot"`
+	FaceValue         float64      `json:"faceValue"`
+	MinPriceIncrement float64      `json:"minPriceIncrement"`
+	Prices            []PricePoint `json:"prices"`
+}
+
+type Operation struct {
+	Account string `json:"account"`
+	schema.Operation
+}
+
+type Scenario struct {
+	Accounts    []Account    `json:"accounts"`
+	Instruments []Instrument `json:"instruments"`
+	Operations  []Operation  `json:"operations"`
+}
+
+func LoadScenario(fname string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := &Scenario{}
+	if err = json.Unmarshal(data, sc); err != nil {
+		return nil, fmt.Errorf("%s: %s", fname, err)
+	}
+
+	if err = sc.Prepare(); err != nil {
+		return nil, fmt.Errorf("%s: %s", fname, err)
+	}
+	return sc, nil
+}
+
+// Prepare validates a scenario built in code and fills in the defaults, LoadScenario does it itself
+func (sc *Scenario) Prepare() error {
+	if len(sc.Accounts) == 0 {
+		sc.Accounts = []Account{{ID: "", Type: "Tinkoff"}}
+	}
+
+	for i := range sc.Instruments {
+		ins := &sc.Instruments[i]
+		if ins.Figi == "" || ins.Ticker == "" {
+			return fmt.Errorf("instrument %d: no figi or ticker", i)
+		}
+		if !schema.Currencies.Has(ins.Currency) {
+			return fmt.Errorf("%s: bad currency %q", ins.Ticker, ins.Currency)
+		}
+		if ins.Lot == 0 {
+			ins.Lot = 1
+		}
+		if ins.Name == "" {
+			ins.Name = ins.Ticker
+		}
+
+		for j := range ins.Prices {
+			t, err := time.Parse("2006/01/02", ins.Prices[j].Date)
+			if err != nil {
+				return fmt.Errorf("%s: %s", ins.Ticker, err)
+			}
+			ins.Prices[j].date = t
+		}
+		sort.Slice(ins.Prices, func(a, b int) bool {
+			return ins.Prices[a].date.Before(ins.Prices[b].date)
+		})
+	}
+
+	for i := range sc.Operations {
+		op := &sc.Operations[i]
+		t, err := time.Parse(time.RFC3339, op.Date)
+		if err != nil {
+			return fmt.Errorf("operation %d: %s", i, err)
+		}
+		op.DateParsed = t
+		if op.ID == "" {
+			op.ID = fmt.Sprint(i + 1)
+		}
+		if op.Status == "" {
+			op.Status = "Done"
+		}
+	}
+
+	sort.SliceStable(sc.Operations, func(a, b int) bool {
+		return sc.Operations[a].DateParsed.Before(sc.Operations[b].DateParsed)
+	})
+	return nil
+}
+
+func (sc *Scenario) byFigi(figi string) *Instrument {
+	for i := range sc.Instruments {
+		if sc.Instruments[i].Figi == figi {
+			return &sc.Instruments[i]
+		}
+	}
+	return nil
+}
+
+func (sc *Scenario) byTicker(ticker string) *Instrument {
+	for i := range sc.Instruments {
+		if sc.Instruments[i].Ticker == ticker {
+			return &sc.Instruments[i]
+		}
+	}
+	return nil
+}
+
+// priceAt returns the last price known at t
+func (ins *Instrument) priceAt(t time.Time) (float64, bool) {
+	idx := sort.Search(len(ins.Prices), func(i int) bool {
+		return ins.Prices[i].date.After(t)
+	})
+	if idx == 0 {
+		return 0, false
+	}
+	return ins.Prices[idx-1].Price, true
+}
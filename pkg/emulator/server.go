@@ -0,0 +1,586 @@
+package emulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"../aux"
+	"../schema"
+)
+
+// Server emulates the OpenAPI endpoints (see api/swagger.yaml) over a scenario.
+// Point MyClient base path to it, e.g. http://127.0.0.1:8080/
+type Server struct {
+	sc *Scenario
+
+	mu      sync.Mutex
+	sandbox map[string]*sandboxAccount // key=brokerAccountId
+	lastID  int
+
+	// time of the emulated "now"
+	now func() time.Time
+}
+
+type sandboxAccount struct {
+	currencies map[string]float64
+	positions  map[string]float64 // key=figi
+}
+
+func NewServer(sc *Scenario) *Server {
+	return &Server{
+		sc:      sc,
+		sandbox: make(map[string]*sandboxAccount),
+		now:     time.Now,
+	}
+}
+
+var slashes = regexp.MustCompile("/+")
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// go-client glues base path and endpoint with an extra slash
+	path := slashes.ReplaceAllString(r.URL.Path, "/")
+	path = strings.TrimPrefix(path, "/openapi")
+
+	// sandbox serves all the usual endpoints too
+	if strings.HasPrefix(path, "/sandbox/") && !aux.IsIn(path,
+		"/sandbox/register",
+		"/sandbox/currencies/balance",
+		"/sandbox/positions/balance",
+		"/sandbox/remove",
+		"/sandbox/clear") {
+		path = strings.TrimPrefix(path, "/sandbox")
+	}
+
+	log.Debugf("emulator: %s %s", r.Method, r.URL)
+
+	handlers := map[string]func(*http.Request) (interface{}, error){
+		"/market/candles":          s.candles,
+		"/market/orderbook":        s.orderbook,
+		"/market/search/by-figi":   s.searchByFigi,
+		"/market/search/by-ticker": s.searchByTicker,
+		"/market/stocks":           s.list("Stock"),
+		"/market/bonds":            s.list("Bond"),
+		"/market/etfs":             s.list("Etf"),
+		"/market/currencies":       s.list("Currency"),
+		"/operations":              s.operations,
+		"/portfolio":               s.portfolio,
+		"/portfolio/currencies":    s.currencies,
+		"/user/accounts":           s.accounts,
+
+		"/sandbox/register":           s.sandboxRegister,
+		"/sandbox/currencies/balance": s.sandboxCurrencies,
+		"/sandbox/positions/balance":  s.sandboxPositions,
+		"/sandbox/remove":             s.sandboxRemove,
+		"/sandbox/clear":              s.sandboxClear,
+	}
+
+	handler, ok := handlers[path]
+	if !ok {
+		reply(w, http.StatusNotFound, nil, fmt.Errorf("no such endpoint %s", path))
+		return
+	}
+
+	s.mu.Lock()
+	payload, err := handler(r)
+	s.mu.Unlock()
+
+	if err != nil {
+		reply(w, http.StatusInternalServerError, nil, err)
+		return
+	}
+	reply(w, http.StatusOK, payload, nil)
+}
+
+func reply(w http.ResponseWriter, status int, payload interface{}, err error) {
+	resp := map[string]interface{}{
+		"trackingId": "emulator",
+		"status":     "Ok",
+		"payload":    payload,
+	}
+	if err != nil {
+		resp["status"] = "Error"
+		resp["payload"] = map[string]string{
+			"message": err.Error(),
+			"code":    "EmulatorError",
+		}
+	}
+	if resp["payload"] == nil {
+		resp["payload"] = struct{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func queryTime(r *http.Request, name string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, r.URL.Query().Get(name))
+	if err != nil {
+		return t, fmt.Errorf("bad %s: %s", name, err)
+	}
+	return t, nil
+}
+
+func (s *Server) instrument(r *http.Request) (*Instrument, error) {
+	figi := r.URL.Query().Get("figi")
+	ins := s.sc.byFigi(figi)
+	if ins == nil {
+		return nil, fmt.Errorf("Instrument not found by figi=%s", figi)
+	}
+	return ins, nil
+}
+
+// =============================================================================
+
+func searchInstrument(ins *Instrument) map[string]interface{} {
+	return map[string]interface{}{
+		"figi":              ins.Figi,
+		"ticker":            ins.Ticker,
+		"isin":              ins.Isin,
+		"minPriceIncrement": ins.MinPriceIncrement,
+		"lot":               ins.Lot,
+		"currency":          ins.Currency,
+		"name":              ins.Name,
+		"type":              ins.Type,
+		"faceValue":         ins.FaceValue,
+	}
+}
+
+func (s *Server) searchByFigi(r *http.Request) (interface{}, error) {
+	ins, err := s.instrument(r)
+	if err != nil {
+		return nil, err
+	}
+	return searchInstrument(ins), nil
+}
+
+func (s *Server) searchByTicker(r *http.Request) (interface{}, error) {
+	instruments := []interface{}{}
+	if ins := s.sc.byTicker(r.URL.Query().Get("ticker")); ins != nil {
+		instruments = append(instruments, searchInstrument(ins))
+	}
+	return map[string]interface{}{
+		"total":       len(instruments),
+		"instruments": instruments,
+	}, nil
+}
+
+func (s *Server) list(typ string) func(*http.Request) (interface{}, error) {
+	return func(r *http.Request) (interface{}, error) {
+		instruments := []interface{}{}
+		for i := range s.sc.Instruments {
+			if ins := &s.sc.Instruments[i]; ins.Type == typ {
+				instruments = append(instruments, searchInstrument(ins))
+			}
+		}
+		return map[string]interface{}{
+			"total":       len(instruments),
+			"instruments": instruments,
+		}, nil
+	}
+}
+
+// =============================================================================
+
+// candleStart returns the beginning of the candle t belongs to
+func candleStart(t time.Time, interval string) (time.Time, error) {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 7, 0, 0, 0, time.UTC)
+	switch interval {
+	case "day":
+		return day, nil
+	case "week":
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7), nil
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 7, 0, 0, 0, time.UTC), nil
+	}
+	return t, fmt.Errorf("unsupported interval %s", interval)
+}
+
+func (s *Server) candles(r *http.Request) (interface{}, error) {
+	ins, err := s.instrument(r)
+	if err != nil {
+		return nil, err
+	}
+	from, err := queryTime(r, "from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := queryTime(r, "to")
+	if err != nil {
+		return nil, err
+	}
+	interval := r.URL.Query().Get("interval")
+
+	pcandles := []schema.Candle{}
+	now := s.now()
+
+	// walk the trading days, merging them into candles
+	for day := time.Date(from.Year(), from.Month(), from.Day(), 7, 0, 0, 0, time.UTC); day.Before(to) && day.Before(now); day = day.AddDate(0, 0, 1) {
+		if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday || day.Before(from) {
+			continue
+		}
+
+		price, ok := ins.priceAt(day)
+		if !ok {
+			continue
+		}
+
+		start, err := candleStart(day, interval)
+		if err != nil {
+			return nil, err
+		}
+
+		if n := len(pcandles); n > 0 && pcandles[n-1].Time == start.Format(time.RFC3339) {
+			c := &pcandles[n-1]
+			c.C = price
+			c.H = math.Max(c.H, price)
+			c.L = math.Min(c.L, price)
+			c.V += 1000
+			continue
+		}
+
+		pcandles = append(pcandles, schema.Candle{
+			Figi:     ins.Figi,
+			Interval: interval,
+			Time:     start.Format(time.RFC3339),
+			O:        price,
+			C:        price,
+			H:        price,
+			L:        price,
+			V:        1000,
+		})
+	}
+
+	return map[string]interface{}{
+		"figi":     ins.Figi,
+		"interval": interval,
+		"candles":  pcandles,
+	}, nil
+}
+
+func (s *Server) orderbook(r *http.Request) (interface{}, error) {
+	ins, err := s.instrument(r)
+	if err != nil {
+		return nil, err
+	}
+
+	price, ok := ins.priceAt(s.now())
+	if !ok {
+		return nil, fmt.Errorf("no price for %s", ins.Ticker)
+	}
+
+	step := ins.MinPriceIncrement
+	if step == 0 {
+		step = 0.01
+	}
+
+	return map[string]interface{}{
+		"figi":              ins.Figi,
+		"depth":             1,
+		"bids":              []interface{}{map[string]interface{}{"price": price - step, "quantity": 100}},
+		"asks":              []interface{}{map[string]interface{}{"price": price + step, "quantity": 100}},
+		"tradeStatus":       "NormalTrading",
+		"minPriceIncrement": step,
+		"faceValue":         ins.FaceValue,
+		"lastPrice":         price,
+		"closePrice":        price,
+		"limitUp":           price * 1.2,
+		"limitDown":         price * 0.8,
+	}, nil
+}
+
+// =============================================================================
+
+func (s *Server) accountOps(acc string) (ops []schema.Operation) {
+	for _, op := range s.sc.Operations {
+		if op.Account == acc {
+			ops = append(ops, op.Operation)
+		}
+	}
+	return
+}
+
+func (s *Server) operations(r *http.Request) (interface{}, error) {
+	from, err := queryTime(r, "from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := queryTime(r, "to")
+	if err != nil {
+		return nil, err
+	}
+	figi := r.URL.Query().Get("figi")
+
+	ops := []schema.Operation{}
+	for _, op := range s.accountOps(r.URL.Query().Get("brokerAccountId")) {
+		if op.DateParsed.Before(from) || op.DateParsed.After(to) {
+			continue
+		}
+		if figi != "" && op.Figi != figi {
+			continue
+		}
+		ops = append(ops, op)
+	}
+
+	// the API lists the newest first
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+
+	return map[string]interface{}{
+		"operations": ops,
+	}, nil
+}
+
+type holding struct {
+	quantity float64
+	cost     float64 // of the quantity held, average price
+}
+
+// holdings rebuilds the positions and cash balances out of the account operations
+func (s *Server) holdings(acc string) (map[string]*holding, map[string]float64) {
+	if sb, ok := s.sandbox[acc]; ok {
+		positions := make(map[string]*holding)
+		for figi, q := range sb.positions {
+			positions[figi] = &holding{quantity: q}
+			if ins := s.sc.byFigi(figi); ins != nil {
+				price, _ := ins.priceAt(s.now())
+				positions[figi].cost = price * q
+			}
+		}
+		return positions, sb.currencies
+	}
+
+	positions := make(map[string]*holding)
+	cash := make(map[string]float64)
+
+	for _, op := range s.accountOps(acc) {
+		if op.Status != "Done" {
+			continue
+		}
+
+		cash[op.Currency] += op.Payment
+		if op.Figi == schema.FigiUSD && op.IsTrading() {
+			cash["USD"] += float64(op.Quantity())
+		}
+
+		if op.Figi == "" || op.Figi == schema.FigiUSD || !op.IsTrading() {
+			continue
+		}
+
+		h := positions[op.Figi]
+		if h == nil {
+			h = &holding{}
+			positions[op.Figi] = h
+		}
+
+		q := float64(op.Quantity())
+		if q > 0 {
+			h.cost += -op.Payment
+		} else if h.quantity > 0 {
+			h.cost *= (h.quantity + q) / h.quantity
+		}
+		h.quantity += q
+
+		if h.quantity <= 0 {
+			delete(positions, op.Figi)
+		}
+	}
+
+	return positions, cash
+}
+
+func money(currency string, value float64) map[string]interface{} {
+	return map[string]interface{}{
+		"currency": currency,
+		"value":    value,
+	}
+}
+
+func (s *Server) portfolio(r *http.Request) (interface{}, error) {
+	positions, cash := s.holdings(r.URL.Query().Get("brokerAccountId"))
+
+	list := []interface{}{}
+	for figi, h := range positions {
+		ins := s.sc.byFigi(figi)
+		if ins == nil {
+			return nil, fmt.Errorf("Instrument not found by figi=%s", figi)
+		}
+
+		price, _ := ins.priceAt(s.now())
+		avg := h.cost / h.quantity
+
+		list = append(list, map[string]interface{}{
+			"figi":                      ins.Figi,
+			"ticker":                    ins.Ticker,
+			"isin":                      ins.Isin,
+			"instrumentType":            ins.Type,
+			"balance":                   h.quantity,
+			"blocked":                   0,
+			"lots":                      int(h.quantity) / ins.Lot,
+			"expectedYield":             money(ins.Currency, (price-avg)*h.quantity),
+			"averagePositionPrice":      money(ins.Currency, avg),
+			"averagePositionPriceNoNkd": money(ins.Currency, avg),
+			"name":                      ins.Name,
+		})
+	}
+
+	// currencies are positions as well
+	if usd := cash["USD"]; usd != 0 {
+		list = append(list, map[string]interface{}{
+			"figi":           schema.FigiUSD,
+			"ticker":         "USD000UTSTOM",
+			"instrumentType": "Currency",
+			"balance":        usd,
+			"lots":           int(usd / 1000),
+			"name":           "Доллар США",
+		})
+	}
+
+	return map[string]interface{}{
+		"positions": list,
+	}, nil
+}
+
+func (s *Server) currencies(r *http.Request) (interface{}, error) {
+	_, cash := s.holdings(r.URL.Query().Get("brokerAccountId"))
+
+	list := []interface{}{}
+	for _, cur := range schema.CurrenciesOrdered {
+		if balance, ok := cash[cur]; ok {
+			list = append(list, map[string]interface{}{
+				"currency": cur,
+				"balance":  balance,
+				"blocked":  0,
+			})
+		}
+	}
+
+	return map[string]interface{}{
+		"currencies": list,
+	}, nil
+}
+
+func (s *Server) accounts(r *http.Request) (interface{}, error) {
+	list := []interface{}{}
+	for _, acc := range s.sc.Accounts {
+		list = append(list, map[string]string{
+			"brokerAccountType": acc.Type,
+			"brokerAccountId":   acc.ID,
+		})
+	}
+	for id := range s.sandbox {
+		list = append(list, map[string]string{
+			"brokerAccountType": "Tinkoff",
+			"brokerAccountId":   id,
+		})
+	}
+
+	return map[string]interface{}{
+		"accounts": list,
+	}, nil
+}
+
+// =============================================================================
+
+func (s *Server) sandboxAccount(r *http.Request) (*sandboxAccount, string, error) {
+	id := r.URL.Query().Get("brokerAccountId")
+	if id == "" {
+		// the first one is the default
+		for sid := range s.sandbox {
+			if id == "" || sid < id {
+				id = sid
+			}
+		}
+	}
+
+	sb, ok := s.sandbox[id]
+	if !ok {
+		return nil, id, fmt.Errorf("Broker account not found: %s", id)
+	}
+	return sb, id, nil
+}
+
+func (s *Server) sandboxRegister(r *http.Request) (interface{}, error) {
+	s.lastID++
+	id := fmt.Sprintf("SB%06d", s.lastID)
+
+	s.sandbox[id] = &sandboxAccount{
+		currencies: make(map[string]float64),
+		positions:  make(map[string]float64),
+	}
+
+	return map[string]string{
+		"brokerAccountType": "Tinkoff",
+		"brokerAccountId":   id,
+	}, nil
+}
+
+func (s *Server) sandboxCurrencies(r *http.Request) (interface{}, error) {
+	sb, _, err := s.sandboxAccount(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req := struct {
+		Currency string  `json:"currency"`
+		Balance  float64 `json:"balance"`
+	}{}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	if !schema.Currencies.Has(req.Currency) {
+		return nil, fmt.Errorf("bad currency %s", req.Currency)
+	}
+
+	sb.currencies[req.Currency] = req.Balance
+	return nil, nil
+}
+
+func (s *Server) sandboxPositions(r *http.Request) (interface{}, error) {
+	sb, _, err := s.sandboxAccount(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req := struct {
+		Figi    string  `json:"figi"`
+		Balance float64 `json:"balance"`
+	}{}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	if s.sc.byFigi(req.Figi) == nil {
+		return nil, fmt.Errorf("Instrument not found by figi=%s", req.Figi)
+	}
+
+	sb.positions[req.Figi] = req.Balance
+	return nil, nil
+}
+
+func (s *Server) sandboxRemove(r *http.Request) (interface{}, error) {
+	_, id, err := s.sandboxAccount(r)
+	if err != nil {
+		return nil, err
+	}
+	delete(s.sandbox, id)
+	return nil, nil
+}
+
+func (s *Server) sandboxClear(r *http.Request) (interface{}, error) {
+	sb, _, err := s.sandboxAccount(r)
+	if err != nil {
+		return nil, err
+	}
+	sb.currencies = make(map[string]float64)
+	sb.positions = make(map[string]float64)
+	return nil, nil
+}
@@ -0,0 +1,100 @@
+package emulator
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"../client"
+	"../schema"
+)
+
+func testScenario(t *testing.T) *Scenario {
+	sc := &Scenario{
+		Instruments: []Instrument{
+			{
+				Figi: "FIGI1", Ticker: "TCK", Type: "Stock", Currency: "RUB", Lot: 10,
+				Prices: []PricePoint{
+					{Date: "2020/01/06", Price: 100},
+					{Date: "2020/01/08", Price: 110},
+				},
+			},
+		},
+		Operations: []Operation{
+			{Operation: schema.Operation{
+				OperationType: "PayIn", Currency: "RUB", Payment: 5000,
+				Date: "2020-01-06T10:00:00Z",
+			}},
+			{Operation: schema.Operation{
+				// partially filled: 30 of 40
+				OperationType: "Buy", Figi: "FIGI1", Currency: "RUB", Payment: -3000, Price: 100, Quantity_: 40,
+				Date:   "2020-01-06T11:00:00Z",
+				Trades: []schema.Trade{{Date: "2020-01-06T11:00:00Z", Price: 100, Quantity: 30}},
+			}},
+		},
+	}
+	if err := sc.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	return sc
+}
+
+func TestEmulator(t *testing.T) {
+	srv := NewServer(testScenario(t))
+	srv.now = func() time.Time {
+		return time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC)
+	}
+
+	hs := httptest.NewServer(srv)
+	defer hs.Close()
+
+	ctx := context.Background()
+	c := client.NewClient("").WithBasePath(hs.URL + "/openapi/")
+
+	ins, err := c.RequestByTicker(ctx, "TCK")
+	if err != nil || ins.Figi != "FIGI1" || ins.Lot != 10 {
+		t.Fatalf("by ticker: %v %v", ins, err)
+	}
+
+	if _, err = c.RequestByFigi(ctx, "NOPE"); err == nil {
+		t.Errorf("found unknown figi")
+	}
+
+	if all, err := c.RequestCatalog(ctx); err != nil || len(all) != 1 || all[0].Ticker != "TCK" {
+		t.Errorf("catalog: %v %v", all, err)
+	}
+
+	ops, err := c.RequestOperations(ctx, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), "")
+	if err != nil || len(ops.Payload.Operations) != 2 {
+		t.Fatalf("operations: %v %v", ops, err)
+	}
+
+	pf, err := c.RequestPortfolio(ctx, "")
+	if err != nil || len(pf.Payload.Positions) != 1 {
+		t.Fatalf("portfolio: %v %v", pf, err)
+	}
+	if pos := pf.Payload.Positions[0]; pos.Balance != 30 || pos.ExpectedYield.Value != 300 {
+		t.Errorf("position: %+v", pos)
+	}
+
+	cur, err := c.RequestCurrencies(ctx, "")
+	if err != nil || len(cur.Payload.Currencies) != 1 || cur.Payload.Currencies[0].Balance != 2000 {
+		t.Errorf("currencies: %+v %v", cur, err)
+	}
+
+	candles, err := c.RequestCandles(ctx, "FIGI1",
+		time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 20, 0, 0, 0, 0, time.UTC), "day")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 6, 7, 8, 9 and 10 of January; the future is unknown
+	if n := len(candles.Payload.Candles); n != 5 || candles.Payload.Candles[4].C != 110 {
+		t.Errorf("candles: %v", candles.Payload.Candles)
+	}
+
+	price, err := c.RequestCurrentPrice(ctx, "FIGI1")
+	if err != nil || price != 110 {
+		t.Errorf("price: %v %v", price, err)
+	}
+}
@@ -13,7 +13,6 @@ package swagger
 import (
 	"context"
 	"io/ioutil"
-	"net/http"
 	"net/url"
 	"strings"
 )
@@ -31,7 +30,7 @@ MarketApiService Получение списка облигаций
 
 
 */
-func (a *MarketApiService) MarketBondsGet(ctx context.Context) (*http.Response, error) {
+func (a *MarketApiService) MarketBondsGet(ctx context.Context) ([]byte, error) {
 	var (
 		localVarHttpMethod = strings.ToUpper("Get")
 		localVarPostBody   interface{}
@@ -70,13 +69,13 @@ func (a *MarketApiService) MarketBondsGet(ctx context.Context) (*http.Response,
 
 	localVarHttpResponse, err := a.client.callAPI(r)
 	if err != nil || localVarHttpResponse == nil {
-		return localVarHttpResponse, err
+		return nil, err
 	}
 
 	localVarBody, err := ioutil.ReadAll(localVarHttpResponse.Body)
 	localVarHttpResponse.Body.Close()
 	if err != nil {
-		return localVarHttpResponse, err
+		return nil, err
 	}
 
 	if localVarHttpResponse.StatusCode >= 300 {
@@ -85,10 +84,10 @@ func (a *MarketApiService) MarketBondsGet(ctx context.Context) (*http.Response,
 			error: localVarHttpResponse.Status,
 		}
 
-		return localVarHttpResponse, newErr
+		return nil, newErr
 	}
 
-	return localVarHttpResponse, nil
+	return localVarBody, nil
 }
 
 /*
@@ -171,7 +170,7 @@ MarketApiService Получение списка валютных пар
 
 
 */
-func (a *MarketApiService) MarketCurrenciesGet(ctx context.Context) (*http.Response, error) {
+func (a *MarketApiService) MarketCurrenciesGet(ctx context.Context) ([]byte, error) {
 	var (
 		localVarHttpMethod = strings.ToUpper("Get")
 		localVarPostBody   interface{}
@@ -210,13 +209,13 @@ func (a *MarketApiService) MarketCurrenciesGet(ctx context.Context) (*http.Respo
 
 	localVarHttpResponse, err := a.client.callAPI(r)
 	if err != nil || localVarHttpResponse == nil {
-		return localVarHttpResponse, err
+		return nil, err
 	}
 
 	localVarBody, err := ioutil.ReadAll(localVarHttpResponse.Body)
 	localVarHttpResponse.Body.Close()
 	if err != nil {
-		return localVarHttpResponse, err
+		return nil, err
 	}
 
 	if localVarHttpResponse.StatusCode >= 300 {
@@ -225,10 +224,10 @@ func (a *MarketApiService) MarketCurrenciesGet(ctx context.Context) (*http.Respo
 			error: localVarHttpResponse.Status,
 		}
 
-		return localVarHttpResponse, newErr
+		return nil, newErr
 	}
 
-	return localVarHttpResponse, nil
+	return localVarBody, nil
 }
 
 /*
@@ -237,7 +236,7 @@ MarketApiService Получение списка ETF
 
 
 */
-func (a *MarketApiService) MarketEtfsGet(ctx context.Context) (*http.Response, error) {
+func (a *MarketApiService) MarketEtfsGet(ctx context.Context) ([]byte, error) {
 	var (
 		localVarHttpMethod = strings.ToUpper("Get")
 		localVarPostBody   interface{}
@@ -276,13 +275,13 @@ func (a *MarketApiService) MarketEtfsGet(ctx context.Context) (*http.Response, e
 
 	localVarHttpResponse, err := a.client.callAPI(r)
 	if err != nil || localVarHttpResponse == nil {
-		return localVarHttpResponse, err
+		return nil, err
 	}
 
 	localVarBody, err := ioutil.ReadAll(localVarHttpResponse.Body)
 	localVarHttpResponse.Body.Close()
 	if err != nil {
-		return localVarHttpResponse, err
+		return nil, err
 	}
 
 	if localVarHttpResponse.StatusCode >= 300 {
@@ -291,10 +290,10 @@ func (a *MarketApiService) MarketEtfsGet(ctx context.Context) (*http.Response, e
 			error: localVarHttpResponse.Status,
 		}
 
-		return localVarHttpResponse, newErr
+		return nil, newErr
 	}
 
-	return localVarHttpResponse, nil
+	return localVarBody, nil
 }
 
 /*
@@ -509,7 +508,7 @@ MarketApiService Получение списка акций
 
 
 */
-func (a *MarketApiService) MarketStocksGet(ctx context.Context) (*http.Response, error) {
+func (a *MarketApiService) MarketStocksGet(ctx context.Context) ([]byte, error) {
 	var (
 		localVarHttpMethod = strings.ToUpper("Get")
 		localVarPostBody   interface{}
@@ -548,13 +547,13 @@ func (a *MarketApiService) MarketStocksGet(ctx context.Context) (*http.Response,
 
 	localVarHttpResponse, err := a.client.callAPI(r)
 	if err != nil || localVarHttpResponse == nil {
-		return localVarHttpResponse, err
+		return nil, err
 	}
 
 	localVarBody, err := ioutil.ReadAll(localVarHttpResponse.Body)
 	localVarHttpResponse.Body.Close()
 	if err != nil {
-		return localVarHttpResponse, err
+		return nil, err
 	}
 
 	if localVarHttpResponse.StatusCode >= 300 {
@@ -563,8 +562,8 @@ func (a *MarketApiService) MarketStocksGet(ctx context.Context) (*http.Response,
 			error: localVarHttpResponse.Status,
 		}
 
-		return localVarHttpResponse, newErr
+		return nil, newErr
 	}
 
-	return localVarHttpResponse, nil
+	return localVarBody, nil
 }
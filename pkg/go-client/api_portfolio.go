@@ -13,7 +13,6 @@ package swagger
 import (
 	"context"
 	"io/ioutil"
-	"net/http"
 	"net/url"
 	"strings"
 )
@@ -38,7 +37,7 @@ type PortfolioCurrenciesGetOpts struct {
 	BrokerAccountId OptionalInterface
 }
 
-func (a *PortfolioApiService) PortfolioCurrenciesGet(ctx context.Context, localVarOptionals *PortfolioCurrenciesGetOpts) (*http.Response, error) {
+func (a *PortfolioApiService) PortfolioCurrenciesGet(ctx context.Context, localVarOptionals *PortfolioCurrenciesGetOpts) ([]byte, error) {
 	var (
 		localVarHttpMethod = strings.ToUpper("Get")
 		localVarPostBody   interface{}
@@ -80,13 +79,13 @@ func (a *PortfolioApiService) PortfolioCurrenciesGet(ctx context.Context, localV
 
 	localVarHttpResponse, err := a.client.callAPI(r)
 	if err != nil || localVarHttpResponse == nil {
-		return localVarHttpResponse, err
+		return nil, err
 	}
 
 	localVarBody, err := ioutil.ReadAll(localVarHttpResponse.Body)
 	localVarHttpResponse.Body.Close()
 	if err != nil {
-		return localVarHttpResponse, err
+		return nil, err
 	}
 
 	if localVarHttpResponse.StatusCode >= 300 {
@@ -95,10 +94,10 @@ func (a *PortfolioApiService) PortfolioCurrenciesGet(ctx context.Context, localV
 			error: localVarHttpResponse.Status,
 		}
 
-		return localVarHttpResponse, newErr
+		return nil, newErr
 	}
 
-	return localVarHttpResponse, nil
+	return localVarBody, nil
 }
 
 /*
@@ -0,0 +1,183 @@
+package portfolio
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"../schema"
+	"../source"
+)
+
+/* By account or by owner: every account, or all the ones of an owner, are a portfolio of their own,
+   printed in a column next to the whole one.
+   A PayOut of one account and the PayIn of the same money into another one are a transfer:
+   they are the payins of the accounts, but not of the whole portfolio. So are the ones between the owners. */
+
+// transferWindow is how far the PayIn of a transfer may be from its PayOut; the brokers
+// date the legs differently, so the PayIn may come first too
+const transferWindow = 7 * 24 * time.Hour
+
+func accountName(acc string) string {
+	owner, id := source.SplitAccount(acc)
+	if id == "" {
+		id = "broker"
+	}
+	if owner != "" {
+		return owner + "/" + id
+	}
+	return id
+}
+
+// columns are the names and the accounts of the parts printed next to the whole portfolio
+func (p *Portfolio) columns() (names []string, groups [][]string) {
+	if p.config.byAccount {
+		for _, acc := range p.accs {
+			names = append(names, accountName(acc))
+			groups = append(groups, []string{acc})
+		}
+		return
+	}
+
+	idx := make(map[string]int)
+	for _, acc := range p.accs {
+		owner, _ := source.SplitAccount(acc)
+		i, ok := idx[owner]
+		if !ok {
+			i = len(names)
+			idx[owner] = i
+			names = append(names, owner)
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], acc)
+	}
+	return
+}
+
+// split tells if the parts are printed
+func (p *Portfolio) split() bool {
+	return p.config.byAccount || p.config.byOwner
+}
+
+// markTransfers pairs every PayOut with the closest PayIn of the same sum into another account
+// within transferWindow, before or after it; ops are sorted by time
+func markTransfers(ops []schema.Operation) {
+	pairs := func(out, in *schema.Operation) bool {
+		return in.OperationType == "PayIn" && in.Status == "Done" && !in.Transfer &&
+			in.Account != out.Account && in.Currency == out.Currency &&
+			math.Abs(in.Payment+out.Payment) < 0.005
+	}
+	dist := func(a, b *schema.Operation) time.Duration {
+		d := a.DateParsed.Sub(b.DateParsed)
+		if d < 0 {
+			return -d
+		}
+		return d
+	}
+
+	for i := range ops {
+		out := &ops[i]
+		if out.OperationType != "PayOut" || out.Status != "Done" || out.Transfer {
+			continue
+		}
+
+		var in *schema.Operation
+		for j := i - 1; j >= 0 && dist(out, &ops[j]) <= transferWindow; j-- {
+			if pairs(out, &ops[j]) {
+				in = &ops[j]
+				break
+			}
+		}
+		for j := i + 1; j < len(ops) && dist(out, &ops[j]) <= transferWindow; j++ {
+			if pairs(out, &ops[j]) {
+				if in == nil || dist(out, &ops[j]) <= dist(out, in) {
+					in = &ops[j]
+				}
+				break
+			}
+		}
+
+		if in != nil {
+			out.Transfer, in.Transfer = true, true
+		}
+	}
+}
+
+func (p *Portfolio) columnPortfolios() []*Portfolio {
+	_, groups := p.columns()
+
+	var list []*Portfolio
+	for _, accs := range groups {
+		list = append(list, p.forAccounts(accs).
+			WithLotMethod(p.config.lotMethod).
+			WithRiskFree(p.config.riskFree).
+			WithTwr(p.config.twr))
+	}
+	return list
+}
+
+// columnNames are the ones of the parts, the whole portfolio is the last
+func (p *Portfolio) columnNames() []string {
+	names, _ := p.columns()
+	return append(names, "total")
+}
+
+func (p *Portfolio) collectAccounts(at time.Time) error {
+	p.accounts = p.columnPortfolios()
+	for _, q := range p.accounts {
+		if err := q.Collect(at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Portfolio) printAccounts(at time.Time) {
+	fmt.Println("== Accounts ==")
+
+	var sbs []schema.SectionedBalance
+	for _, q := range p.accounts {
+		sbs = append(sbs, q.balance)
+	}
+	schema.PrintColumns(at, p.columnNames(), append(sbs, p.balance), "")
+}
+
+// listAccountBalances prints the times all the parts have a balance of;
+// it returns the context error if it was interrupted
+func (p *Portfolio) listAccountBalances(start time.Time, period, format string) error {
+	ports := append(p.columnPortfolios(), p)
+
+	var times []time.Time // of the whole portfolio
+	balances := make([]map[int64]schema.SectionedBalance, len(ports))
+
+	for i, q := range ports {
+		balances[i] = make(map[int64]schema.SectionedBalance)
+		err := q.forBalances(start, period, func(t time.Time, obal schema.SectionedBalance) {
+			balances[i][t.Unix()] = obal
+			if q == p {
+				times = append(times, t)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	names := p.columnNames()
+	schema.PrintColumnsHead(names, format)
+
+	for _, t := range times {
+		var row []schema.SectionedBalance
+		for _, b := range balances {
+			if obal, ok := b[t.Unix()]; ok {
+				row = append(row, obal)
+			}
+		}
+		if len(row) < len(ports) {
+			// some prices are missing
+			continue
+		}
+		schema.PrintColumnsRow(t, names, row, format)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package portfolio
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"../schema"
+)
+
+func TestMarkTransfers(t *testing.T) {
+	op := func(day int, acc, typ string, payment float64) schema.Operation {
+		return schema.Operation{
+			DateParsed:    time.Date(2021, 3, day, 12, 0, 0, 0, time.UTC),
+			Account:       acc,
+			OperationType: typ,
+			Payment:       payment,
+			Currency:      "RUB",
+			Status:        "Done",
+		}
+	}
+
+	ops := []schema.Operation{
+		op(1, "", "PayIn", 1000),
+		op(2, "", "PayOut", -400),    // to the iis
+		op(2, "iis", "PayIn", 300),   // another sum
+		op(3, "iis", "PayIn", 400),   // the transfer
+		op(4, "", "PayOut", -500),    // out of the portfolio: the next one is too late
+		op(20, "iis", "PayIn", 500),  // a payin
+		op(21, "iis", "PayOut", -50), // to the same account only
+		op(21, "iis", "PayIn", 50),
+		op(25, "", "PayIn", 700), // the transfer, the PayIn leg dated first
+		op(26, "iis", "PayOut", -700),
+	}
+	markTransfers(ops)
+
+	for i, exp := range []bool{false, true, false, true, false, false, false, false, true, true} {
+		if ops[i].Transfer != exp {
+			t.Errorf("op %d (%s %.0f): transfer %v, exp %v", i, ops[i].OperationType, ops[i].Payment, ops[i].Transfer, exp)
+		}
+	}
+}
+
+func TestColumns(t *testing.T) {
+	p := NewPortfolio(nil, nil, []string{"alice/", "alice/2001", "bob/2002"}, "", "").WithByOwner(true)
+
+	names, groups := p.columns()
+	if fmt.Sprint(names, groups) != "[alice bob] [[alice/ alice/2001] [bob/2002]]" {
+		t.Errorf("by owner: %v %v", names, groups)
+	}
+
+	names, groups = p.WithByAccount(true).columns()
+	if fmt.Sprint(names, groups) != "[alice/broker alice/2001 bob/2002] [[alice/] [alice/2001] [bob/2002]]" {
+		t.Errorf("by account: %v %v", names, groups)
+	}
+}
@@ -12,7 +12,11 @@ func (p *Portfolio) collectAccrued() {
 	p.config.enableAccrued = true
 
 	for _, acc := range p.accs {
-		pfResp := p.client.RequestPortfolio(acc)
+		pfResp, err := p.src.RequestPortfolio(p.ctx, acc)
+		if err != nil {
+			log.Warnf("no accrued values for account %q: %s", acc, err)
+			continue
+		}
 		for _, pos := range pfResp.Payload.Positions {
 			p.accrued[pos.Figi] = pos.AveragePositionPrice.Value - pos.AveragePositionPriceNoNkd.Value
 		}
@@ -20,23 +24,24 @@ func (p *Portfolio) collectAccrued() {
 }
 
 func (p *Portfolio) getAccrued(pinfo *schema.PositionInfo, date time.Time) float64 {
-	if !p.config.enableAccrued {
-		return 0
-	}
 	if pinfo.Ins.Type != schema.InsTypeBond {
 		return 0
 	}
 
-	// Accrued value cannot be fetched for date != Now
-	if time.Now().Sub(date).Hours() > 24 {
-		log.Warnf("missing accrued value for %s, balance is inaccurate", pinfo.Ins.Figi)
-		return 0
+	// the broker's value is the exact one, but it cannot be fetched for date != Now
+	if p.config.enableAccrued && time.Now().Sub(date).Hours() <= 24 {
+		if accrued, ok := p.accrued[pinfo.Ins.Figi]; ok {
+			return accrued
+		}
 	}
 
-	accrued, ok := p.accrued[pinfo.Ins.Figi]
-	if !ok {
-		log.Warnf("missing accrued value for %s, balance is inaccurate", pinfo.Ins.Figi)
-		return 0
+	if accrued, ok := pinfo.Schedule.Accrued(date, pinfo.Ins.FaceValue); ok {
+		return accrued
+	}
+
+	if p.config.enableAccrued {
+		log.Warnf("missing accrued value for %s at %s, balance is inaccurate",
+			pinfo.Ins.Figi, date.Format("2006/01/02"))
 	}
-	return accrued
+	return 0
 }
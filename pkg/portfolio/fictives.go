@@ -1,6 +1,7 @@
 package portfolio
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -10,8 +11,8 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"../candles"
-	"../client"
 	"../schema"
+	"../source"
 )
 
 type FictiveDeal struct {
@@ -35,7 +36,7 @@ func readFictives(fname string) (ops []FictiveDeal) {
 	return
 }
 
-func fetchFictives(c *client.MyClient, cc *candles.CandleCache, fname string) (ops []schema.Operation) {
+func fetchFictives(ctx context.Context, c source.Instruments, cc *candles.CandleCache, fname string) (ops []schema.Operation) {
 	var totalAmount float64
 
 	fs := readFictives(fname)
@@ -56,13 +57,17 @@ func fetchFictives(c *client.MyClient, cc *candles.CandleCache, fname string) (o
 			return
 		}
 
-		ins, err := c.TryRequestByTicker(op.Ticker)
+		ins, err := c.RequestByTicker(ctx, op.Ticker)
 		if err != nil {
 			log.Errorf("bad ticker %s: %s", op.Ticker, err)
 			return
 		}
 
-		price := cc.Get(ins.Figi, date)
+		price, err := cc.TryGet(ins.Figi, date)
+		if err != nil {
+			log.Errorf("no price for %s: %s", op.Ticker, err)
+			return
+		}
 		n := uint(math.Round(op.Amount/(price*float64(ins.Lot)))) * uint(ins.Lot)
 		pment := price * float64(n)
 
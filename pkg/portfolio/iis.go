@@ -0,0 +1,203 @@
+package portfolio
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"../schema"
+)
+
+/* IIS rules (individual investment account):
+   - payins are capped: 400K RUB a year till 2016, 1M since 2017; no cap for the accounts
+     opened since 2024 (IIS-3)
+   - type A deduction: 13% of the payins of the year, up to 400K of them;
+     it is also limited by the NDFL paid that year, which is not known here
+   - the account must live at least 3 years, 5 for the ones opened in 2024,
+     one more for every year after, up to 10; any payout, transfer or securities
+     move out before that breaks the tax status, and the deductions are to be returned. */
+
+// iisStart is when IIS were introduced
+var iisStart = time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	iisDeductionRate = 0.13
+	iisDeductionBase = 400000
+)
+
+func iisCap(year int, opened time.Time) float64 {
+	switch {
+	case opened.Year() >= 2024:
+		return math.Inf(1)
+	case year < 2017:
+		return 400000
+	default:
+		return 1000000
+	}
+}
+
+// iisTerm returns the date the account may be closed without losing the tax status
+func iisTerm(opened time.Time) time.Time {
+	years := 3
+	if opened.Year() >= 2024 {
+		years = 5 + opened.Year() - 2024
+		if years > 10 {
+			years = 10
+		}
+	}
+	return opened.AddDate(years, 0, 0)
+}
+
+type iisYear struct {
+	year      int
+	payins    float64
+	cap       float64
+	deduction float64
+}
+
+// ListIis prints the payins, the deductions and the term of every IIS account of iisAccs,
+// which are a part of the accounts of the portfolio. Returns the context error if it was interrupted.
+func (p *Portfolio) ListIis(iisAccs []string) error {
+	if len(iisAccs) == 0 {
+		fmt.Println("no IIS accounts")
+		return p.ctx.Err()
+	}
+
+	reports, err := p.iisReports(iisAccs)
+	if err != nil {
+		return err
+	}
+	for _, r := range reports {
+		r.print()
+	}
+	return nil
+}
+
+type iisReport struct {
+	acc      string
+	opened   time.Time // zero if there are no operations
+	term     time.Time
+	years    []*iisYear
+	warnings []string
+}
+
+// iisReports takes the operations of all the accounts of the portfolio, so that the transfers
+// between an IIS and the others are marked, and reports the ones of iisAccs
+func (p *Portfolio) iisReports(iisAccs []string) ([]iisReport, error) {
+	all, err := p.getOperations(iisStart)
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []iisReport
+	for _, acc := range iisAccs {
+		var ops []schema.Operation
+		for _, op := range all {
+			if op.Account == acc {
+				ops = append(ops, op)
+			}
+		}
+		reports = append(reports, newIisReport(acc, ops))
+	}
+	return reports, nil
+}
+
+// iisBreach is the warning about op if it takes money or securities out before the term
+func iisBreach(op schema.Operation, term time.Time) (string, bool) {
+	if !op.DateParsed.Before(term) {
+		return "", false
+	}
+
+	what := ""
+	switch {
+	case op.OperationType == "PayOut" && op.Transfer:
+		what = fmt.Sprintf("transfer of %.2f %s to another account", -op.Payment, op.Currency)
+	case op.OperationType == "PayOut":
+		what = fmt.Sprintf("PayOut %.2f %s", -op.Payment, op.Currency)
+	case op.OperationType == "SecurityOut":
+		what = fmt.Sprintf("SecurityOut of %d %s", op.Quantity_, op.Figi)
+	default:
+		return "", false
+	}
+	return fmt.Sprintf("%s: %s before %s breaks the tax status",
+		op.DateParsed.Format("2006/01/02"), what, term.Format("2006/01/02")), true
+}
+
+func newIisReport(acc string, ops []schema.Operation) iisReport {
+	r := iisReport{acc: acc}
+
+	for _, op := range ops {
+		if op.Status == "Done" {
+			r.opened = op.DateParsed
+			break
+		}
+	}
+	if r.opened.IsZero() {
+		return r
+	}
+	r.term = iisTerm(r.opened)
+
+	years := make(map[int]*iisYear)
+
+	for _, op := range ops {
+		if op.Status != "Done" {
+			continue
+		}
+
+		switch op.OperationType {
+		case "PayIn":
+			y := op.DateParsed.Year()
+			if years[y] == nil {
+				years[y] = &iisYear{year: y, cap: iisCap(y, r.opened)}
+			}
+			if op.Currency != "RUB" {
+				r.warnings = append(r.warnings, fmt.Sprintf("%s: PayIn in %s, only RUB is accepted",
+					op.DateParsed.Format("2006/01/02"), op.Currency))
+			}
+			years[y].payins += op.Payment
+
+		default:
+			if w, ok := iisBreach(op, r.term); ok {
+				r.warnings = append(r.warnings, w)
+			}
+		}
+	}
+
+	for _, y := range years {
+		y.deduction = iisDeductionRate * math.Min(y.payins, iisDeductionBase)
+		if y.payins > y.cap {
+			r.warnings = append(r.warnings, fmt.Sprintf("%d: payins %.2f are over the %.0f cap",
+				y.year, y.payins, y.cap))
+		}
+		r.years = append(r.years, y)
+	}
+	sort.Slice(r.years, func(i, j int) bool {
+		return r.years[i].year < r.years[j].year
+	})
+	return r
+}
+
+func (r iisReport) print() {
+	fmt.Printf("== IIS %s ==\n", accountName(r.acc))
+
+	if r.opened.IsZero() {
+		fmt.Println("  no operations")
+		return
+	}
+	fmt.Printf("  opened %s, the minimum term ends %s\n",
+		r.opened.Format("2006/01/02"), r.term.Format("2006/01/02"))
+
+	fmt.Printf("  %-4s %12s %12s %12s\n", "year", "payins", "cap", "deduction A")
+	for _, y := range r.years {
+		capStr := "-"
+		if !math.IsInf(y.cap, 1) {
+			capStr = fmt.Sprintf("%.2f", y.cap)
+		}
+		fmt.Printf("  %-4d %12.2f %12s %12.2f\n", y.year, y.payins, capStr, y.deduction)
+	}
+
+	for _, w := range r.warnings {
+		fmt.Println("  warning: " + w)
+	}
+}
@@ -0,0 +1,92 @@
+package portfolio
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"../emulator"
+	"../schema"
+)
+
+func TestIisRules(t *testing.T) {
+	date := func(y int) time.Time {
+		return time.Date(y, 3, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	for _, c := range []struct {
+		opened int
+		year   int
+		cap    float64
+		term   int
+	}{
+		{2015, 2016, 400000, 2018},
+		{2015, 2017, 1000000, 2018},
+		{2023, 2024, 1000000, 2026},
+		{2024, 2024, math.Inf(1), 2029},
+		{2027, 2027, math.Inf(1), 2035},
+		{2031, 2031, math.Inf(1), 2041},
+	} {
+		if cap := iisCap(c.year, date(c.opened)); cap != c.cap {
+			t.Errorf("opened %d, cap of %d: %.0f, exp %.0f", c.opened, c.year, cap, c.cap)
+		}
+		if term := iisTerm(date(c.opened)); !term.Equal(date(c.term)) {
+			t.Errorf("opened %d, term %s, exp %d", c.opened, term.Format("2006/01/02"), c.term)
+		}
+	}
+}
+
+func TestIisBreach(t *testing.T) {
+	term := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	before, after := term.AddDate(0, -1, 0), term.AddDate(0, 1, 0)
+
+	for _, c := range []struct {
+		op  schema.Operation
+		exp string
+	}{
+		{schema.Operation{OperationType: "PayOut", Payment: -100, Currency: "RUB", DateParsed: before},
+			"2023/02/01: PayOut 100.00 RUB before 2023/03/01 breaks the tax status"},
+		{schema.Operation{OperationType: "PayOut", Payment: -100, Currency: "RUB", DateParsed: before, Transfer: true},
+			"2023/02/01: transfer of 100.00 RUB to another account before 2023/03/01 breaks the tax status"},
+		{schema.Operation{OperationType: "SecurityOut", Figi: "FIGI1", Quantity_: 5, DateParsed: before},
+			"2023/02/01: SecurityOut of 5 FIGI1 before 2023/03/01 breaks the tax status"},
+		{schema.Operation{OperationType: "PayOut", Payment: -100, Currency: "RUB", DateParsed: after}, ""},
+		{schema.Operation{OperationType: "SecurityIn", Figi: "FIGI1", Quantity_: 5, DateParsed: before}, ""},
+	} {
+		if w, ok := iisBreach(c.op, term); w != c.exp || ok != (c.exp != "") {
+			t.Errorf("%s: %q, exp %q", c.op.OperationType, w, c.exp)
+		}
+	}
+}
+
+func TestIisTransfer(t *testing.T) {
+	iisOp := func(typ string, payment float64, date string) emulator.Operation {
+		o := op(typ, "", payment, 0, 0, date)
+		o.Account = "IIS1"
+		return o
+	}
+	sc := &emulator.Scenario{
+		Accounts: []emulator.Account{{ID: "", Type: "Tinkoff"}, {ID: "IIS1", Type: "TinkoffIis"}},
+		Operations: []emulator.Operation{
+			iisOp("PayIn", 100000, "2021-01-10T10:00:00Z"),
+			iisOp("PayOut", -50000, "2022-03-01T10:00:00Z"),
+			op("PayIn", "", 50000, 0, 0, "2022-03-02T10:00:00Z"),
+		},
+	}
+
+	p, stop := testPortfolio(t, sc)
+	defer stop()
+	p.accs = []string{"", "IIS1"}
+
+	reports, err := p.iisReports([]string{"IIS1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || len(reports[0].warnings) != 1 {
+		t.Fatalf("%+v, exp a report with a warning", reports)
+	}
+	exp := "2022/03/01: transfer of 50000.00 RUB to another account before 2024/01/10 breaks the tax status"
+	if w := reports[0].warnings[0]; w != exp {
+		t.Errorf("%q, exp %q", w, exp)
+	}
+}
@@ -8,33 +8,66 @@ import (
 	"../schema"
 )
 
-func (p *Portfolio) insByFigi(figi string) schema.Instrument {
+func (p *Portfolio) tryInsByFigi(figi string) (schema.Instrument, error) {
 	ins, ok := p.instruments[figi]
 	if !ok {
-		ins = p.client.RequestByFigi(figi)
+		var err error
+		ins, err = p.src.RequestByFigi(p.ctx, figi)
+		if err != nil {
+			return ins, err
+		}
 		p.instruments[figi] = ins
 	}
 	log.Debug(ins)
+	return ins, nil
+}
+
+// insByOperation falls back to what the operation itself knows about the instrument
+// if the lookup fails, so that one bad figi does not stop the whole run
+func (p *Portfolio) insByOperation(op schema.Operation) schema.Instrument {
+	ins, err := p.tryInsByFigi(op.Figi)
+	if err != nil {
+		log.Errorf("%s; using stub instrument, balance is inaccurate", err)
+
+		ins = schema.NewInstrument(op.Figi, op.Figi, op.Figi, op.InstrumentType, op.Currency, 0, 1)
+		p.instruments[op.Figi] = ins
+	}
 	return ins
 }
 
-func (p *Portfolio) insByTicker(ticker string) schema.Instrument {
+// bondSchedule is nil for the instruments without one
+func (p *Portfolio) bondSchedule(figi string) *schema.BondSchedule {
+	isin := ""
+	if ins, err := p.tryInsByFigi(figi); err == nil {
+		isin = ins.Isin
+	}
+	return p.config.bonds.Schedule(figi, isin)
+}
+
+func (p *Portfolio) tryInsByTicker(ticker string) (schema.Instrument, error) {
 	for _, ins := range p.instruments {
 		if ins.Ticker == ticker {
-			return ins
+			return ins, nil
 		}
 	}
 
-	ins := p.client.RequestByTicker(ticker)
+	ins, err := p.src.RequestByTicker(p.ctx, ticker)
+	if err != nil {
+		return ins, err
+	}
 	p.instruments[ins.Figi] = ins
-	return ins
+	return ins, nil
 }
 
 func (p *Portfolio) tryGetTicker(figi string) string {
 	if figi == "" {
 		return ""
 	}
-	return p.insByFigi(figi).Ticker
+	ins, err := p.tryInsByFigi(figi)
+	if err != nil {
+		return figi
+	}
+	return ins.Ticker
 }
 
 func (p *Portfolio) benchPricef(ins schema.Instrument) schema.PriceAt {
@@ -43,7 +76,11 @@ func (p *Portfolio) benchPricef(ins schema.Instrument) schema.PriceAt {
 		return nil
 	}
 
-	bins := p.insByTicker(bench)
+	bins, err := p.tryInsByTicker(bench)
+	if err != nil {
+		log.Warnf("no benchmark for %s: %s", ins.Ticker, err)
+		return nil
+	}
 
 	return func(t time.Time) float64 {
 		return p.cc.GetInCurrency(bins, ins.Currency, t)
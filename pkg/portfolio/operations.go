@@ -29,11 +29,18 @@ func readOperations(fname string) (ops []schema.Operation) {
 	return ops
 }
 
-func (p *Portfolio) getOperations(start time.Time) (ops []schema.Operation) {
+// getOperations returns the request error, e.g. the context one if it was interrupted
+func (p *Portfolio) getOperations(start time.Time) (ops []schema.Operation, err error) {
 	if p.config.fictFile == "" {
 		for _, acc := range p.accs {
-			resp := p.client.RequestOperations(start, acc)
-			ops = append(ops, resp.Payload.Operations...)
+			resp, err := p.src.RequestOperations(p.ctx, start, acc)
+			if err != nil {
+				return nil, err
+			}
+			for _, op := range resp.Payload.Operations {
+				op.Account = acc
+				ops = append(ops, op)
+			}
 		}
 	}
 
@@ -42,27 +49,28 @@ func (p *Portfolio) getOperations(start time.Time) (ops []schema.Operation) {
 	}
 
 	if p.config.fictFile != "" {
-		ops = append(ops, fetchFictives(p.client, p.cc, p.config.fictFile)...)
+		ops = append(ops, fetchFictives(p.ctx, p.src, p.cc, p.config.fictFile)...)
 	}
 
 	for i := range ops {
-		var err error
 		ops[i].DateParsed, err = time.Parse(time.RFC3339, ops[i].Date)
 		if err != nil {
 			log.Fatalf("Failed to parse time: %v", err)
 		}
 
-		/* hashtag #repayment_hacks
-		   Repayments come with delay, and if there were trading ops in the middle,
-		   their value calculation breaks.
-		   Uglyhack it here as I dont know what to do yet */
-		if ops[i].Figi == "BBG00LFKPBJ0" && ops[i].OperationType == "PartRepayment" {
-			ops[i].DateParsed = ops[i].DateParsed.Add(-24 * time.Hour)
+		// Repayments come with delay, and if there were trading ops in the middle,
+		// their value calculation breaks
+		if ops[i].OperationType == "PartRepayment" {
+			ops[i].DateParsed = p.bondSchedule(ops[i].Figi).ReportDate(ops[i].DateParsed)
 		}
 	}
 
 	sort.Slice(ops, func(i, j int) bool {
 		return ops[i].DateParsed.Before(ops[j].DateParsed)
 	})
-	return
+
+	if len(p.accs) > 1 {
+		markTransfers(ops)
+	}
+	return ops, p.ctx.Err()
 }
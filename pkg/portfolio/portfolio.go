@@ -1,21 +1,24 @@
 package portfolio
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"../aux"
 	"../candles"
-	"../client"
 	"../schema"
+	"../source"
 )
 
 var beginning = time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
 
 type Portfolio struct {
-	client *client.MyClient
+	ctx context.Context
+	src source.Source
 
 	accs []string
 
@@ -23,7 +26,8 @@ type Portfolio struct {
 		ops []schema.Operation
 	}
 
-	cc *candles.CandleCache
+	cc    *candles.CandleCache
+	store *candles.Store
 
 	instruments map[string]schema.Instrument // key=figi
 	positions   map[string]*schema.PositionInfo
@@ -34,18 +38,32 @@ type Portfolio struct {
 
 	balance schema.SectionedBalance
 	alphas  schema.CurMap
+	cash    *schema.Balance // out of the operations only
+	twr     *schema.TwrTracker
+	flowTwr bool          // twr is marked at every flow day, not by the caller
+	series  []seriesPoint // of the story
+
+	accounts []*Portfolio // the parts, when split
 
 	config struct {
 		enableAccrued bool
 		opsFile       string
 		fictFile      string
+		lotMethod     schema.LotMethod
+		actions       *schema.Actions
+		bonds         *schema.Bonds
+		riskFree      float64
+		byAccount     bool
+		byOwner       bool
+		twr           bool
 	}
 }
 
-func NewPortfolio(c *client.MyClient, accs []string, opsFile, fictFile string) *Portfolio {
+func NewPortfolio(ctx context.Context, src source.Source, accs []string, opsFile, fictFile string) *Portfolio {
 	p := &Portfolio{
-		client: c,
-		accs:   accs,
+		ctx:  ctx,
+		src:  src,
+		accs: accs,
 
 		instruments: make(map[string]schema.Instrument),
 		positions:   make(map[string]*schema.PositionInfo),
@@ -55,9 +73,67 @@ func NewPortfolio(c *client.MyClient, accs []string, opsFile, fictFile string) *
 	}
 	p.config.opsFile = opsFile
 	p.config.fictFile = fictFile
+	p.config.lotMethod = schema.LotFifo
+	p.config.actions = schema.DefaultActions()
+	p.config.bonds = schema.DefaultBonds()
+	return p
+}
+
+// WithLotMethod sets how sells are matched to buys for the realized P&L
+func (p *Portfolio) WithLotMethod(m schema.LotMethod) *Portfolio {
+	p.config.lotMethod = m
+	return p
+}
+
+// WithActions replaces the built in corporate actions
+func (p *Portfolio) WithActions(a *schema.Actions) *Portfolio {
+	p.config.actions = a
+	return p
+}
+
+// WithBonds replaces the built in bond schedules
+func (p *Portfolio) WithBonds(b *schema.Bonds) *Portfolio {
+	p.config.bonds = b
+	return p
+}
+
+// WithRiskFree sets the annual rate the story's Sharpe and Sortino ratios are against, 0.07 for 7%
+func (p *Portfolio) WithRiskFree(rate float64) *Portfolio {
+	p.config.riskFree = rate
+	return p
+}
+
+// WithByAccount makes show, story and deals print every account next to the total
+func (p *Portfolio) WithByAccount(on bool) *Portfolio {
+	p.config.byAccount = on
+	return p
+}
+
+// WithByOwner makes show, story and deals print the accounts of every owner of a household next to the total;
+// WithByAccount splits them further
+func (p *Portfolio) WithByOwner(on bool) *Portfolio {
+	p.config.byOwner = on
+	return p
+}
+
+// WithTwr makes show print the time-weighted returns; it values the portfolio at every day of the flows
+func (p *Portfolio) WithTwr(on bool) *Portfolio {
+	p.config.twr = on
+	return p
+}
+
+// WithCandleStore makes the portfolio keep the candles on disk between runs
+func (p *Portfolio) WithCandleStore(s *candles.Store) *Portfolio {
+	p.store = s
 	return p
 }
 
+func (p *Portfolio) newCandleCache() *candles.CandleCache {
+	return candles.NewCandleCache(p.ctx, p.src).
+		WithStore(p.store).
+		WithActions(p.config.actions, p.src)
+}
+
 // =============================================================================
 
 func (p *Portfolio) payins() float64 {
@@ -82,16 +158,23 @@ func (p *Portfolio) alphaCorrectedAssets() float64 {
 
 // =============================================================================
 
+// addPosition returns the position of the instrument the operation one has become by now
 func (p *Portfolio) addPosition(op schema.Operation) *schema.PositionInfo {
+	op.Figi, _ = p.config.actions.Successor(op.Figi, "", op.DateParsed)
+
 	if pinfo := p.positions[op.Figi]; pinfo != nil {
 		return pinfo
 	}
 
+	ins := p.insByOperation(op)
 	pinfo := &schema.PositionInfo{
-		Ins: p.insByFigi(op.Figi),
+		Ins: ins,
 
 		AccumulatedIncome: schema.NewCValue(0, op.Currency),
+		Actions:           p.config.actions,
+		Schedule:          p.config.bonds.Schedule(ins.Figi, ins.Isin),
 	}
+	pinfo.Lots.Method = p.config.lotMethod
 
 	p.positions[op.Figi] = pinfo
 	return pinfo
@@ -99,66 +182,139 @@ func (p *Portfolio) addPosition(op schema.Operation) *schema.PositionInfo {
 
 // =============================================================================
 
-func (p *Portfolio) processOperations(cb func(*schema.Balance, time.Time) bool) *schema.Balance {
-	p.data.ops = p.getOperations(beginning)
+// processOperations returns the error of getting the operations, with an empty balance
+func (p *Portfolio) processOperations(cb func(*schema.Balance, time.Time) bool) (*schema.Balance, error) {
+	bal := schema.NewBalance()
 
-	p.preprocessOperations()
+	var err error
+	if p.data.ops, err = p.getOperations(beginning); err != nil {
+		return bal, err
+	}
 
-	bal := schema.NewBalance()
+	p.preprocessOperations()
 
 	for _, op := range p.data.ops {
+		if p.ctx.Err() != nil {
+			break
+		}
+
 		if op.Status != "Done" {
 			// cancelled declined etc
 			// noone is interested in that
 			continue
 		}
 
+		if op.Transfer {
+			// the money has stayed in the portfolio
+			continue
+		}
+
 		if !cb(bal, op.DateParsed) {
 			break
 		}
 
 		log.Debugf("operation: %v", op)
 
+		// the rate of the operation is cached then, and the interrupted one leaves no trace
+		if _, err := p.cc.TryXchgrate(op.Currency, "RUB", op.DateParsed); err != nil {
+			if p.ctx.Err() != nil {
+				break
+			}
+			log.Fatalf("No rate for %v: %s", op, err)
+		}
+
+		if p.flowTwr && isFlow(op) && p.twr.NeedsMark(op.DateParsed) {
+			at := op.DateParsed
+			if op.IsPayment() {
+				// the coupon or the repaid nominal are out of the value of its time already
+				at = at.Add(-time.Second)
+			}
+			sb := p.valuate(*bal, at)
+			if p.ctx.Err() != nil {
+				// some prices are missing
+				break
+			}
+			p.twr.Mark(sb, op.DateParsed)
+		}
+
 		if op.Figi != "" {
 			pinfo := p.addPosition(op)
-			deal, isDeal := pinfo.AddOperation(op)
+			deal, isDeal := pinfo.AddOperation(op, p.cc.Xchgrate)
 			if isDeal {
 				bal.AddDeal(deal, pinfo.Ins.Figi)
+
+				if p.twr != nil && pinfo.Ins.Figi != schema.FigiUSD {
+					p.twr.AddDeal(pinfo.Ins,
+						deal.Value()*p.cc.Xchgrate(deal.Price.Currency, "RUB", deal.Date))
+				}
+			} else if p.twr != nil && op.IsPayment() {
+				p.twr.AddIncome(pinfo.Ins, op.Payment*p.cc.Xchgrate(op.Currency, "RUB", op.DateParsed))
 			}
 		}
 
 		bal.AddOperation(op, p.cc.Xchgrate)
 
+		if p.twr != nil && aux.IsIn(op.OperationType, "PayIn", "PayOut") {
+			p.twr.AddPayin(op.Payment*p.cc.Xchgrate(op.Currency, "RUB", op.DateParsed), op.DateParsed)
+		}
+
 		log.Debugf(" [%s] %s at %s (%f) new balance: %f",
 			op.OperationType, p.tryGetTicker(op.Figi),
 			op.DateParsed.Format("2006/01/02"), op.Payment, bal.Assets["RUB"].Value)
 	}
 
-	return bal
+	return bal, nil
+}
+
+// isFlow tells the operations that move money in or out of the portfolio or its sections
+func isFlow(op schema.Operation) bool {
+	return aux.IsIn(op.OperationType, "PayIn", "PayOut") || op.IsTrading() && op.Figi != schema.FigiUSD ||
+		op.IsPayment() && op.Figi != ""
 }
 
 // =============================================================================
 
-func (p *Portfolio) getFullPrice(pinfo *schema.PositionInfo, t time.Time) float64 {
-	return p.cc.Get(pinfo.Ins.Figi, t)*pinfo.RepaymentMultiplier(t) + p.getAccrued(pinfo, t)
+func (p *Portfolio) getFullPrice(pinfo *schema.PositionInfo, t time.Time) (float64, error) {
+	if date, ok := p.config.actions.Delisted(pinfo.Ins.Figi, pinfo.Ins.Ticker); ok && !t.Before(date) {
+		// written off
+		return 0, nil
+	}
+
+	price, err := p.cc.TryGet(pinfo.Ins.Figi, t)
+	if err != nil {
+		return 0, err
+	}
+	return price*pinfo.RepaymentMultiplier(t) + p.getAccrued(pinfo, t), nil
 }
 
 func (p *Portfolio) openDealsSectionedBalance(time time.Time) schema.SectionedBalance {
 	sb := schema.NewSectionedBalance()
 
 	for _, pinfo := range p.positions {
+		var priceErr error
+
 		od, hasOd := pinfo.MakeOpenDeal(time,
 			func() float64 {
-				return p.getFullPrice(pinfo, time)
+				price, err := p.getFullPrice(pinfo, time)
+				priceErr = err
+				return price
 			})
 
+		if priceErr != nil {
+			if p.ctx.Err() != nil {
+				break
+			}
+			log.Warnf("no price for %s, skipping it, balance is inaccurate: %s", pinfo.Ins.Ticker, priceErr)
+			continue
+		}
+
 		if !hasOd || pinfo.Ins.Figi == schema.FigiUSD {
 			continue
 		}
 
 		log.Debugf("open deal %s %s %s", pinfo.Ins.Figi, pinfo.Ins.Ticker, od)
 
-		sb.AddDeal(od, pinfo.Ins.Figi, pinfo.Ins.Section)
+		sb.AddDeal(od, pinfo.Ins)
 	}
 
 	return sb
@@ -170,19 +326,32 @@ func (p *Portfolio) openDealsBalance(time time.Time) *schema.Balance {
 	return sb.Total
 }
 
-func (p *Portfolio) Collect(at time.Time) {
+// Collect returns the context error if it was interrupted;
+// the balance is incomplete then, but whatever was collected may be printed
+func (p *Portfolio) Collect(at time.Time) error {
 	if p.config.fictFile == "" {
 		p.collectAccrued()
 	}
 
-	p.cc = candles.NewCandleCache(p.client)
+	p.cc = p.newCandleCache()
+	p.twr, p.flowTwr = nil, p.config.twr
+	if p.flowTwr {
+		p.twr = schema.NewTwrTracker()
+	}
 
-	cash := p.processOperations(func(bal *schema.Balance, opTime time.Time) bool {
+	cash, err := p.processOperations(func(bal *schema.Balance, opTime time.Time) bool {
 		return opTime.Before(at)
 	})
+	if err != nil {
+		p.cash = cash
+		p.balance = schema.NewSectionedBalance()
+		return err
+	}
 
+	p.cash = cash
 	p.balance = p.openDealsSectionedBalance(at)
 	p.balance.Total.Add(*cash)
+	p.balance.Twr = p.twr
 
 	for _, pinfo := range p.positions {
 		pinfo.Finalize(p.benchPricef(pinfo.Ins))
@@ -190,17 +359,42 @@ func (p *Portfolio) Collect(at time.Time) {
 	}
 
 	p.calcAllAssets(p.balance, p.alphas, at)
+
+	if p.split() {
+		return p.collectAccounts(at)
+	}
+	return p.ctx.Err()
 }
 
 // =============================================================================
 
-func (p *Portfolio) ListDeals(start, end time.Time) {
-	empty := true
+// ListDeals returns the error of getting the operations, e.g. the context one if it was interrupted
+func (p *Portfolio) ListDeals(start, end time.Time) error {
+	var err error
+	if p.data.ops, err = p.getOperations(start); err != nil {
+		return err
+	}
 
-	p.data.ops = p.getOperations(start)
+	type totals struct {
+		deals, comms *schema.Balance
+		empty        bool
+	}
+	newTotals := func() *totals {
+		return &totals{schema.NewBalance(), schema.NewBalance(), true}
+	}
+
+	all := newTotals()
+
+	names, groups := p.columns()
+	parts := make([]*totals, len(names))
+	part := make(map[string]*totals) // key=account
+	for i, accs := range groups {
+		parts[i] = newTotals()
+		for _, acc := range accs {
+			part[acc] = parts[i]
+		}
+	}
 
-	deals := schema.NewBalance()
-	comms := schema.NewBalance()
 	for _, op := range p.data.ops {
 		if op.DateParsed.After(end) {
 			break
@@ -213,25 +407,57 @@ func (p *Portfolio) ListDeals(start, end time.Time) {
 		}
 
 		if op.Figi != "" {
-			op.Ticker = p.insByFigi(op.Figi).Ticker
+			op.Ticker = p.tryGetTicker(op.Figi)
+		}
+		if p.split() {
+			fmt.Printf("[%s] %s\n", accountName(op.Account), op.StringPretty())
+		} else {
+			fmt.Printf("%s\n", op.StringPretty())
 		}
-		fmt.Printf("%s\n", op.StringPretty())
 
 		// exploit those balance maps for totals
-		if op.IsTrading() {
-			deals.Assets[op.Currency].Value += math.Abs(op.Payment)
-			empty = false
-		} else if op.OperationType == "ServiceCommission" || op.OperationType == "BrokerCommission" {
-			comms.Assets[op.Currency].Value += math.Abs(op.Payment)
-			empty = false
+		for _, t := range []*totals{all, part[op.Account]} {
+			if t == nil {
+				// of the side operations
+				continue
+			}
+			if op.IsTrading() {
+				t.deals.Assets[op.Currency].Value += math.Abs(op.Payment)
+				t.empty = false
+			} else if op.OperationType == "ServiceCommission" || op.OperationType == "BrokerCommission" {
+				t.comms.Assets[op.Currency].Value += math.Abs(op.Payment)
+				t.empty = false
+			}
 		}
 	}
 
-	if empty {
-		return
+	if all.empty {
+		return nil
+	}
+
+	usdrate, err := p.src.RequestCurrentPrice(p.ctx, schema.FigiUSD)
+	if err != nil {
+		log.Warnf("no usd rate: %s", err)
+	}
+
+	if p.split() {
+		for i, t := range parts {
+			if !t.empty {
+				printDealTotals(names[i], t.deals, t.comms, usdrate)
+			}
+		}
+	}
+	printDealTotals("", all.deals, all.comms, usdrate)
+	return nil
+}
+
+// printDealTotals skips the percentage if there is no usd rate
+func printDealTotals(name string, deals, comms *schema.Balance, usdrate float64) {
+	if name != "" {
+		name = " (" + name + ")"
 	}
 
-	fmt.Printf(" - Total deals:\n")
+	fmt.Printf(" - Total deals%s:\n", name)
 	for _, c := range schema.CurrenciesOrdered {
 		if deals.Assets[c].Value != 0 {
 			fmt.Printf("\t %s\n", deals.Assets[c])
@@ -244,7 +470,9 @@ func (p *Portfolio) ListDeals(start, end time.Time) {
 		}
 	}
 
-	usdrate := p.client.RequestCurrentPrice(schema.FigiUSD)
+	if usdrate == 0 {
+		return
+	}
 	fmt.Printf("   percentage: %.2f%%\n", comms.CalcAllAssets(usdrate, 0)/deals.CalcAllAssets(usdrate, 0)*100)
 }
 
@@ -260,17 +488,21 @@ func (p *Portfolio) calcAllAssets(sb schema.SectionedBalance, alphas schema.CurM
 	}
 }
 
-func (p *Portfolio) summarize( /* const */ bal schema.Balance, t time.Time, format string) {
+// valuate is the balance at t, with the open positions at the prices of t
+func (p *Portfolio) valuate( /* const */ bal schema.Balance, t time.Time) schema.SectionedBalance {
 	obal := p.openDealsSectionedBalance(t)
 	obal.Total.Add(bal)
 
 	p.calcAllAssets(obal, nil, t)
-
-	obal.Print(t, t.Format("2006/01/02"), format)
+	return obal
 }
 
-func (p *Portfolio) ListBalances(start time.Time, period, format string) {
-	p.cc = candles.NewCandleCache(p.client).WithPeriod(start, period)
+// forBalances calls cb with the balance at every time of the period;
+// it returns the context error if it was interrupted, the balances passed by then are complete
+func (p *Portfolio) forBalances(start time.Time, period string, cb func(time.Time, schema.SectionedBalance)) error {
+	p.cc = p.newCandleCache().WithPeriod(start, period)
+	// marked at the times of the period only, they are valued anyway
+	p.twr, p.flowTwr = schema.NewTwrTracker(), false
 
 	candleTimes := p.cc.ListTimes()
 
@@ -279,12 +511,22 @@ func (p *Portfolio) ListBalances(start time.Time, period, format string) {
 
 	if num == 0 {
 		log.Debug("No data for this period")
-		return
+		return p.ctx.Err()
 	}
 
-	schema.PrintBalanceHead(format)
+	summarize := func( /* const */ bal schema.Balance, t time.Time) {
+		obal := p.valuate(bal, t)
+		obal.Twr = p.twr
+
+		if p.ctx.Err() != nil {
+			// some prices are missing
+			return
+		}
+		p.twr.Mark(obal, t)
+		cb(t, obal)
+	}
 
-	bal := p.processOperations(func(bal *schema.Balance, opTime time.Time) bool {
+	bal, err := p.processOperations(func(bal *schema.Balance, opTime time.Time) bool {
 
 		// process all candles before opTime
 
@@ -293,11 +535,14 @@ func (p *Portfolio) ListBalances(start time.Time, period, format string) {
 			if opTime.Before(nextTime) {
 				break
 			}
-			p.summarize(*bal, nextTime, format)
+			summarize(*bal, nextTime)
 		}
 
 		return true
 	})
+	if err != nil {
+		return err
+	}
 
 	log.Debugf("cash balance: %s", bal.Assets)
 
@@ -305,6 +550,44 @@ func (p *Portfolio) ListBalances(start time.Time, period, format string) {
 
 	for ; cidx < num; cidx += 1 {
 		nextTime := candleTimes[cidx]
-		p.summarize(*bal, nextTime, format)
+		summarize(*bal, nextTime)
+	}
+
+	return p.ctx.Err()
+}
+
+// ListBalances returns the context error if it was interrupted,
+// the balances printed by then are complete
+func (p *Portfolio) ListBalances(start time.Time, period, format string) error {
+	if p.split() {
+		return p.listAccountBalances(start, period, format)
+	}
+
+	p.series = nil
+	printed := false
+
+	err := p.forBalances(start, period, func(t time.Time, obal schema.SectionedBalance) {
+		if !printed {
+			schema.PrintBalanceHead(format)
+			printed = true
+		}
+		obal.Print(t, t.Format("2006/01/02"), format)
+
+		if obal.Total.Assets["all"].Value > 0 {
+			p.series = append(p.series, seriesPoint{t, p.twr.Ratio(obal)})
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// the table is for the machines
+	if printed && format != schema.TableStyle {
+		p.printRisk()
+
+		for _, ins := range p.unclassified() {
+			log.Warnf("%s (%s) is not in the section shares, add it to the sections", ins.Ticker, ins.Figi)
+		}
 	}
+	return nil
 }
@@ -0,0 +1,38 @@
+package portfolio
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"../emulator"
+	"../schema"
+)
+
+func TestSectionTwr(t *testing.T) {
+	sc := &emulator.Scenario{
+		Instruments: []emulator.Instrument{
+			// at par, half of the 1000 nominal repaid
+			{Figi: "BOND1", Ticker: "RU000BOND1", Type: "Bond", Currency: "RUB", Lot: 1, FaceValue: 500,
+				Prices: []emulator.PricePoint{{Date: "2020/01/01", Price: 500}}},
+		},
+		Operations: []emulator.Operation{
+			op("PayIn", "", 10000, 0, 0, "2020-01-10T10:00:00Z"),
+			op("Buy", "BOND1", -10000, 1000, 10, "2020-01-10T11:00:00Z"),
+			op("Coupon", "BOND1", 300, 0, 0, "2020-02-01T10:00:00Z"),
+			op("PartRepayment", "BOND1", 5000, 0, 0, "2020-03-10T10:00:00Z"),
+		},
+	}
+
+	p, stop := testPortfolio(t, sc)
+	defer stop()
+
+	if err := p.WithTwr(true).Collect(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the coupon is the only return: 10000 -> 9700 + 300, then 10000 / 9700; the repayment is none
+	if r := p.twr.SectionRatio(p.balance, schema.BondRu); math.Abs(r-10000/9700.0) > 1e-6 {
+		t.Errorf("bonds twr %.4f, exp %.4f", r, 10000/9700.0)
+	}
+}
@@ -0,0 +1,108 @@
+package portfolio
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"../schema"
+)
+
+// storyInstruments resolves the tickers and figis asked for, fatal if one is unknown
+func (p *Portfolio) storyInstruments(tickers, figis []string) []schema.Instrument {
+	var list []schema.Instrument
+	for _, ticker := range tickers {
+		ins, err := p.tryInsByTicker(ticker)
+		if err != nil {
+			log.Fatalf("unknown ticker %s: %s", ticker, err)
+		}
+		list = append(list, ins)
+	}
+	for _, figi := range figis {
+		ins, err := p.tryInsByFigi(figi)
+		if err != nil {
+			log.Fatalf("unknown figi %s: %s", figi, err)
+		}
+		list = append(list, ins)
+	}
+	return list
+}
+
+func (p *Portfolio) positionPoint(pinfo *schema.PositionInfo, t time.Time) (schema.PositionPoint, bool) {
+	price := 0.0
+	if pinfo.OpenQuantity != 0 {
+		var err error
+		if price, err = p.getFullPrice(pinfo, t); err != nil {
+			if p.ctx.Err() == nil {
+				log.Warnf("no price for %s at %s, skipping it: %s", pinfo.Ins.Ticker, t.Format("2006/01/02"), err)
+			}
+			return schema.PositionPoint{}, false
+		}
+	}
+	return schema.NewPositionPoint(pinfo, t, price), true
+}
+
+// ListPositionStory replays the positions of the instruments over the times of the period,
+// like ListBalances does the whole portfolio; it returns the context error if it was interrupted
+func (p *Portfolio) ListPositionStory(tickers, figis []string, start time.Time, period, format string) error {
+	p.cc = p.newCandleCache().WithPeriod(start, period)
+
+	instruments := p.storyInstruments(tickers, figis)
+	points := make(map[string][]schema.PositionPoint)
+
+	candleTimes := p.cc.ListTimes()
+	cidx := 0
+	num := len(candleTimes)
+
+	if num == 0 {
+		log.Debug("No data for this period")
+		return p.ctx.Err()
+	}
+
+	summarize := func(t time.Time) {
+		for _, ins := range instruments {
+			pinfo := p.positions[ins.Figi]
+			if pinfo == nil || len(pinfo.Deals) == 0 {
+				// not bought yet
+				continue
+			}
+			if pt, ok := p.positionPoint(pinfo, t); ok {
+				points[ins.Figi] = append(points[ins.Figi], pt)
+			}
+		}
+	}
+
+	_, err := p.processOperations(func(bal *schema.Balance, opTime time.Time) bool {
+		for ; cidx < num; cidx += 1 {
+			nextTime := candleTimes[cidx]
+			if opTime.Before(nextTime) {
+				break
+			}
+			summarize(nextTime)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for ; cidx < num; cidx += 1 {
+		summarize(candleTimes[cidx])
+	}
+
+	schema.PrintPositionHead(format)
+	for _, ins := range instruments {
+		if format != schema.TableStyle {
+			fmt.Printf("== %s (%s) ==\n", ins.Ticker, ins.Name)
+		}
+		if len(points[ins.Figi]) == 0 && format != schema.TableStyle {
+			fmt.Println("  never held in the period")
+		}
+		for _, pt := range points[ins.Figi] {
+			pt.Print(ins, format)
+		}
+	}
+
+	return p.ctx.Err()
+}
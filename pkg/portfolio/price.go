@@ -1,13 +1,16 @@
 package portfolio
 
 import (
+	"context"
 	"fmt"
 	"time"
 
+	log "github.com/sirupsen/logrus"
+
 	"../aux"
 	"../candles"
-	"../client"
 	"../schema"
+	"../source"
 )
 
 type price struct {
@@ -86,12 +89,16 @@ func printTable(hs []history) {
 	}
 }
 
-func GetPrices(c *client.MyClient, tickers []string, start, end time.Time, period, format string) {
-	hs := make([]history, len(tickers))
+// GetPrices returns the context error if it was interrupted,
+// the prices fetched by then are printed anyway
+func GetPrices(ctx context.Context, c source.Market, store *candles.Store,
+	actions *schema.Actions, bonds *schema.Bonds, tickers []string, start, end time.Time, period, format string) error {
+
+	hs := []history{}
 	times := []time.Time{}
 	curr := ""
 
-	cc := candles.NewCandleCache(c)
+	cc := candles.NewCandleCache(ctx, c).WithStore(store).WithActions(actions, c).WithBonds(bonds, c)
 
 	if period == "" {
 		times = []time.Time{start, end}
@@ -100,27 +107,52 @@ func GetPrices(c *client.MyClient, tickers []string, start, end time.Time, perio
 		times = cc.ListTimes()
 	}
 
-	for i, ticker := range tickers {
-		hs[i] = history{
-			ins:    c.RequestByTicker(ticker),
-			prices: make([]price, len(times)),
+	for _, ticker := range tickers {
+		ins, err := c.RequestByTicker(ctx, ticker)
+		if err != nil {
+			log.Errorf("skipping %s: %s", ticker, err)
+			continue
 		}
+
+		hs = append(hs, history{
+			ins:    ins,
+			prices: make([]price, len(times)),
+		})
 		if curr == "" {
-			curr = hs[i].ins.Currency
-		} else if curr != hs[i].ins.Currency {
+			curr = ins.Currency
+		} else if curr != ins.Currency {
 			curr = "RUB"
 		}
 	}
 
+	if len(hs) == 0 {
+		return ctx.Err()
+	}
+
 	for i := range hs {
-		h := &hs[i]
-		h.curr = curr
-		for i, t := range times {
+		hs[i].curr = curr
+	}
+
+	for i, t := range times {
+		for j := range hs {
+			h := &hs[j]
 			h.prices[i] = price{
 				time:  t,
 				price: cc.GetInCurrency(h.ins, curr, t),
 			}
 		}
+
+		if ctx.Err() != nil {
+			// keep the complete rows only
+			for j := range hs {
+				hs[j].prices = hs[j].prices[:i]
+			}
+			break
+		}
+	}
+
+	if len(hs[0].prices) == 0 {
+		return ctx.Err()
 	}
 
 	if format == "human" {
@@ -128,4 +160,6 @@ func GetPrices(c *client.MyClient, tickers []string, start, end time.Time, perio
 	} else {
 		printTable(hs)
 	}
+
+	return ctx.Err()
 }
@@ -0,0 +1,66 @@
+package portfolio
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"../schema"
+)
+
+type sale struct {
+	schema.Sale
+	ticker string
+}
+
+// realized returns the sales made in year, ordered by date
+func (p *Portfolio) realized(year int) []sale {
+	var sales []sale
+	for _, pinfo := range p.positions {
+		for _, s := range pinfo.Lots.Sales {
+			if s.Date.Year() == year {
+				sales = append(sales, sale{s, pinfo.Ins.Ticker})
+			}
+		}
+	}
+
+	sort.Slice(sales, func(i, j int) bool {
+		return sales[i].Date.Before(sales[j].Date)
+	})
+	return sales
+}
+
+// ListRealized prints the realized P&L of every sale made in year, matched to the lots
+// by the portfolio lot method. Returns the context error if it was interrupted.
+func (p *Portfolio) ListRealized(year int) error {
+	p.cc = p.newCandleCache()
+
+	_, err := p.processOperations(func(bal *schema.Balance, opTime time.Time) bool {
+		return opTime.Year() <= year
+	})
+	if err != nil {
+		return err
+	}
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+
+	fmt.Printf("== Realized in %d (%s) ==\n", year, p.config.lotMethod)
+
+	sales := p.realized(year)
+	if len(sales) == 0 {
+		fmt.Println("  no sales")
+		return nil
+	}
+
+	totals := schema.NewCurMap()
+	totalRub := 0.0
+	for _, s := range sales {
+		fmt.Printf("  %-12s %s\n", s.ticker, s.Sale)
+		totals.Add(s.Profit())
+		totalRub += s.ProfitRub()
+	}
+
+	fmt.Printf(" - Total: %s; RUB %.2f at the deal dates\n", totals, totalRub)
+	return nil
+}
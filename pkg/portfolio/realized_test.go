@@ -0,0 +1,46 @@
+package portfolio
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"../emulator"
+	"../schema"
+)
+
+func TestRealizedEur(t *testing.T) {
+	eur := func(o emulator.Operation) emulator.Operation {
+		o.Currency = "EUR"
+		return o
+	}
+
+	sc := &emulator.Scenario{
+		Instruments: []emulator.Instrument{
+			{Figi: schema.FigiEUR, Ticker: "EUR_RUB__TOM", Type: "Currency", Currency: "RUB", Lot: 1000,
+				Prices: []emulator.PricePoint{{Date: "2019/01/01", Price: 80}, {Date: "2020/03/01", Price: 90}}},
+			{Figi: "FIGI1", Ticker: "EURS", Type: "Stock", Currency: "EUR", Lot: 1,
+				Prices: []emulator.PricePoint{{Date: "2020/01/01", Price: 10}}},
+		},
+		Operations: []emulator.Operation{
+			eur(op("PayIn", "", 1000, 0, 0, "2020-01-10T10:00:00Z")),
+			eur(op("Buy", "FIGI1", -100, 10, 10, "2020-01-10T11:00:00Z")),
+			eur(op("Sell", "FIGI1", 120, 12, 10, "2020-03-10T11:00:00Z")),
+		},
+	}
+
+	p, stop := testPortfolio(t, sc)
+	defer stop()
+
+	if err := p.Collect(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	sales := p.realized(2020)
+	if len(sales) != 1 {
+		t.Fatalf("sales: %v", sales)
+	}
+	if profit := sales[0].ProfitRub(); math.Abs(profit-(120*90-100*80)) > 1e-6 {
+		t.Errorf("profit %.2f RUB, exp 2800", profit)
+	}
+}
@@ -0,0 +1,182 @@
+package portfolio
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"../schema"
+	"../source"
+)
+
+/* Rebalance proposes whole-lot orders that bring the positions closer to the targets,
+   at the best bid or ask of now. The buys are never more than the cash and the sells make. */
+
+type order struct {
+	target schema.Target
+	ins    schema.Instrument
+
+	now, want float64 // RUB
+	held      int     // lots of the ticker
+
+	price  float64 // of a piece, in the instrument currency
+	lotRub float64
+	lots   int // negative for sells
+}
+
+// planLots fills the lots of the orders; without sells, the buys are of the cash only
+func planLots(orders []*order, cash float64, sells bool) {
+	avail := cash
+	if sells {
+		for _, o := range orders {
+			if d := o.want - o.now; d < 0 {
+				n := int(-d / o.lotRub)
+				if n > o.held {
+					n = o.held
+				}
+				o.lots = -n
+				avail += float64(n) * o.lotRub
+			}
+		}
+	}
+
+	need := 0.0
+	for _, o := range orders {
+		if d := o.want - o.now; d > 0 {
+			need += d
+		}
+	}
+	scale := 1.0
+	if need > avail {
+		scale = math.Max(avail, 0) / need
+	}
+
+	for _, o := range orders {
+		if d := o.want - o.now; d > 0 {
+			o.lots = int(math.Floor(d * scale / o.lotRub))
+		}
+	}
+}
+
+// positionRub is the value of the open position now
+func (p *Portfolio) positionRub(pinfo *schema.PositionInfo, t time.Time) float64 {
+	return -pinfo.OpenDeal.Value() * p.cc.Xchgrate(pinfo.Ins.Currency, "RUB", t)
+}
+
+// newOrder is nil if there is no price for the ticker
+func (p *Portfolio) newOrder(targets *schema.Targets, target schema.Target, books source.Orderbooks, t time.Time) *order {
+	ins, err := p.tryInsByTicker(target.Ticker)
+	if err != nil {
+		log.Warnf("skipping %s: %s", target, err)
+		return nil
+	}
+
+	o := &order{target: target, ins: ins}
+	if pinfo := p.positions[ins.Figi]; pinfo != nil && ins.Lot > 0 {
+		o.held = pinfo.OpenQuantity / ins.Lot
+	}
+
+	resp, err := books.RequestOrderbook(p.ctx, ins.Figi)
+	if err != nil {
+		log.Warnf("skipping %s: %s", target, err)
+		return nil
+	}
+	book := resp.Payload
+	if book.TradeStatus != "" && book.TradeStatus != "NormalTrading" {
+		log.Warnf("%s: %s", target, book.TradeStatus)
+	}
+
+	o.price = book.LastPrice
+	if len(book.Asks) > 0 {
+		o.price = book.Asks[0].Price
+	}
+	for _, pinfo := range p.positions {
+		if !pinfo.IsClosed() {
+			if share := targets.Covers(target, pinfo.Ins); share > 0 {
+				o.now += share * p.positionRub(pinfo, t)
+			}
+		}
+	}
+	o.want = target.Weight / 100 * p.assets()
+	if o.want < o.now && len(book.Bids) > 0 {
+		o.price = book.Bids[0].Price
+	}
+
+	if o.price <= 0 || ins.Lot <= 0 {
+		log.Warnf("skipping %s: no price", target)
+		return nil
+	}
+	o.lotRub = o.price * float64(ins.Lot) * p.cc.Xchgrate(ins.Currency, "RUB", t)
+	return o
+}
+
+// Rebalance prints the orders to reach the targets; sells is false to use the cash only.
+// Returns the context error if it was interrupted.
+func (p *Portfolio) Rebalance(targets *schema.Targets, books source.Orderbooks, sells bool, format string) error {
+	now := time.Now()
+
+	if err := p.Collect(now); err != nil {
+		return err
+	}
+
+	total := p.assets()
+	cash := total
+	for _, pinfo := range p.positions {
+		if !pinfo.IsClosed() && pinfo.Ins.Figi != schema.FigiUSD {
+			cash -= p.positionRub(pinfo, now)
+		}
+	}
+
+	var orders []*order
+	for _, target := range targets.Targets {
+		if o := p.newOrder(targets, target, books, now); o != nil {
+			orders = append(orders, o)
+		}
+		if err := p.ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	planLots(orders, cash, sells)
+
+	perc := func(v float64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return v / total * 100
+	}
+
+	if format == schema.TableStyle {
+		fmt.Println("target, weight, target.weight, lots, quantity, price, currency, rub, weight.after")
+	} else {
+		fmt.Printf("== Rebalance: %.0f RUB, cash %.0f RUB ==\n", total, cash)
+	}
+
+	for _, o := range orders {
+		rub := float64(o.lots) * o.lotRub
+		cash -= rub
+		if format == schema.TableStyle {
+			fmt.Printf("%s, %.1f, %.1f, %d, %d, %.2f, %s, %.0f, %.1f\n",
+				o.target, perc(o.now), o.target.Weight, o.lots, o.lots*o.ins.Lot,
+				o.price, o.ins.Currency, rub, perc(o.now+rub))
+			continue
+		}
+
+		action, lots := "hold", o.lots
+		if lots > 0 {
+			action = "buy "
+		} else if lots < 0 {
+			action, lots = "sell", -lots
+		}
+		fmt.Printf("  %-20s %5.1f%% -> %5.1f%%: %s %4d lots (%5d) at %10.2f %s = %9.0f RUB, then %5.1f%%\n",
+			o.target, perc(o.now), o.target.Weight, action, lots, lots*o.ins.Lot,
+			o.price, o.ins.Currency, math.Abs(rub), perc(o.now+rub))
+	}
+
+	if format != schema.TableStyle {
+		fmt.Printf("  cash left %.0f RUB (%.1f%%)\n", cash, perc(cash))
+	}
+	return nil
+}
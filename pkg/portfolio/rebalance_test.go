@@ -0,0 +1,36 @@
+package portfolio
+
+import (
+	"testing"
+)
+
+func TestPlanLots(t *testing.T) {
+	newOrders := func() []*order {
+		return []*order{
+			{now: 1000, want: 3500, lotRub: 100},          // buy 25
+			{now: 3000, want: 2000, lotRub: 300, held: 5}, // sell 3
+			{now: 500, want: 100, lotRub: 100, held: 2},   // sell 2, all of them
+			{now: 1000, want: 1050, lotRub: 100},          // less than a lot
+		}
+	}
+
+	for _, c := range []struct {
+		cash  float64
+		sells bool
+		lots  []int
+	}{
+		{10000, true, []int{25, -3, -2, 0}},
+		{0, true, []int{10, -3, -2, 0}},     // 1100 of the sells for 2550 of the buys
+		{1275, false, []int{12, 0, 0, 0}},   // half of the buys
+		{100000, false, []int{25, 0, 0, 0}}, // never more than the target
+		{-100, false, []int{0, 0, 0, 0}},
+	} {
+		orders := newOrders()
+		planLots(orders, c.cash, c.sells)
+		for i, o := range orders {
+			if o.lots != c.lots[i] {
+				t.Errorf("cash %.0f, sells %v: order %d, %d lots, exp %d", c.cash, c.sells, i, o.lots, c.lots[i])
+			}
+		}
+	}
+}
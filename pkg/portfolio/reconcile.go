@@ -0,0 +1,214 @@
+package portfolio
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+
+	"../schema"
+)
+
+type CashDiff struct {
+	Currency string
+	Computed float64 // out of the operations
+	Reported float64 // by the broker
+}
+
+func (d CashDiff) Diff() float64 {
+	return d.Computed - d.Reported
+}
+
+// CheckCash compares the cash computed by Collect with the current broker balances.
+// A difference means some operation was mishandled, or is missing.
+func (p *Portfolio) CheckCash() ([]CashDiff, error) {
+	reported := make(map[string]float64)
+	for _, acc := range p.accs {
+		resp, err := p.src.RequestCurrencies(p.ctx, acc)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range resp.Payload.Currencies {
+			if !schema.Currencies.Has(c.Currency) {
+				log.Warnf("unsupported currency %s: %.2f", c.Currency, c.Balance)
+				continue
+			}
+			reported[c.Currency] += c.Balance
+		}
+	}
+
+	var diffs []CashDiff
+	for _, cur := range schema.CurrenciesOrdered {
+		computed := p.cash.Assets[cur].Value
+		if _, ok := reported[cur]; !ok && computed == 0 {
+			continue
+		}
+		diffs = append(diffs, CashDiff{
+			Currency: cur,
+			Computed: computed,
+			Reported: reported[cur],
+		})
+	}
+	return diffs, nil
+}
+
+func PrintCash(diffs []CashDiff) {
+	fmt.Println("== Cash ==")
+	for _, d := range diffs {
+		fmt.Printf("  %s: computed %10.2f, reported %10.2f, diff %8.2f\n",
+			d.Currency, d.Computed, d.Reported, d.Diff())
+	}
+}
+
+// =============================================================================
+
+// what is still considered a match
+const (
+	avgPriceTolerance = 0.005 // relative
+	yieldTolerance    = 0.01  // relative to the position value
+	minTolerance      = 1.0   // in the position currency
+)
+
+type Discrepancy struct {
+	Ticker string
+	Figi   string
+	What   string
+
+	Ours   float64
+	Broker float64
+}
+
+func (d Discrepancy) String() string {
+	return fmt.Sprintf("%-12s %-14s ours %12.2f, broker %12.2f, diff %10.2f",
+		d.Ticker, d.What, d.Ours, d.Broker, d.Ours-d.Broker)
+}
+
+type brokerPosition struct {
+	ticker        string
+	balance       float64
+	blocked       float64
+	lots          float64
+	avgPrice      float64
+	expectedYield float64
+}
+
+// brokerPositions sums up /portfolio over the accounts, key=figi
+func (p *Portfolio) brokerPositions() (map[string]*brokerPosition, error) {
+	res := make(map[string]*brokerPosition)
+
+	for _, acc := range p.accs {
+		resp, err := p.src.RequestPortfolio(p.ctx, acc)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pos := range resp.Payload.Positions {
+			if schema.InsType(pos.InstrumentType) == schema.InsTypeCurrency {
+				// cash is checked by CheckCash
+				continue
+			}
+
+			avgPrice := pos.AveragePositionPrice.Value
+			if pos.AveragePositionPriceNoNkd.Value != 0 {
+				avgPrice = pos.AveragePositionPriceNoNkd.Value
+			}
+
+			bp := res[pos.Figi]
+			if bp == nil {
+				bp = &brokerPosition{ticker: pos.Ticker}
+				res[pos.Figi] = bp
+			}
+
+			// average of the accounts, weighted by the balance
+			if total := bp.balance + pos.Balance; total != 0 {
+				bp.avgPrice = (bp.avgPrice*bp.balance + avgPrice*pos.Balance) / total
+			}
+			bp.balance += pos.Balance
+			bp.blocked += pos.Blocked
+			bp.lots += pos.Lots
+			bp.expectedYield += pos.ExpectedYield.Value
+		}
+	}
+
+	return res, nil
+}
+
+// ReconcilePositions compares the open positions rebuilt by Collect with the broker's /portfolio
+func (p *Portfolio) ReconcilePositions() ([]Discrepancy, error) {
+	broker, err := p.brokerPositions()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Discrepancy
+	add := func(ticker, figi, what string, ours, theirs float64) {
+		res = append(res, Discrepancy{ticker, figi, what, ours, theirs})
+	}
+
+	figis := make(map[string]bool)
+	for figi, pinfo := range p.positions {
+		if pinfo.OpenQuantity != 0 && pinfo.Ins.Type != schema.InsTypeCurrency {
+			figis[figi] = true
+		}
+	}
+	for figi := range broker {
+		figis[figi] = true
+	}
+
+	for figi := range figis {
+		bp := broker[figi]
+		if bp == nil {
+			bp = &brokerPosition{}
+		}
+
+		ticker, quantity := bp.ticker, 0.0
+		pinfo := p.positions[figi]
+		if pinfo != nil {
+			ticker, quantity = pinfo.Ins.Ticker, float64(pinfo.OpenQuantity)
+		}
+
+		if quantity != bp.balance {
+			add(ticker, figi, "quantity", quantity, bp.balance)
+			continue
+		}
+		if pinfo == nil {
+			continue
+		}
+		if lot := float64(pinfo.Ins.Lot); lot != 0 && bp.lots*lot != bp.balance {
+			add(ticker, figi, "lots", bp.balance/lot, bp.lots)
+		}
+		if bp.blocked != 0 {
+			log.Infof("%s: %.0f blocked by orders", ticker, bp.blocked)
+		}
+
+		avgPrice := pinfo.AveragePrice()
+		if math.Abs(avgPrice-bp.avgPrice) > avgPriceTolerance*math.Abs(bp.avgPrice) {
+			add(ticker, figi, "average price", avgPrice, bp.avgPrice)
+		}
+
+		if pinfo.IsClosed() {
+			continue
+		}
+		value := pinfo.OpenDeal.Price.Value * quantity
+		yield := value - avgPrice*quantity
+		if math.Abs(yield-bp.expectedYield) > math.Max(minTolerance, yieldTolerance*math.Abs(value)) {
+			add(ticker, figi, "expected yield", yield, bp.expectedYield)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Ticker < res[j].Ticker
+	})
+	return res, nil
+}
+
+func PrintDiscrepancies(ds []Discrepancy) {
+	fmt.Println("== Positions ==")
+	for _, d := range ds {
+		fmt.Println("  " + d.String())
+	}
+	if len(ds) == 0 {
+		fmt.Println("  all match")
+	}
+}
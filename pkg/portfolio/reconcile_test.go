@@ -0,0 +1,80 @@
+package portfolio
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"../client"
+	"../emulator"
+	"../schema"
+)
+
+func testPortfolio(t *testing.T, sc *emulator.Scenario) (*Portfolio, func()) {
+	sc.Instruments = append(sc.Instruments, emulator.Instrument{
+		Figi: schema.FigiUSD, Ticker: "USD000UTSTOM", Type: "Currency", Currency: "RUB", Lot: 1000,
+		Prices: []emulator.PricePoint{{Date: "2019/01/01", Price: 70}},
+	})
+	if err := sc.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	hs := httptest.NewServer(emulator.NewServer(sc))
+	c := client.NewClient("").WithBasePath(hs.URL + "/openapi/")
+
+	return NewPortfolio(context.Background(), c, []string{""}, "", ""), hs.Close
+}
+
+func op(typ, figi string, payment, price float64, quantity uint, date string) emulator.Operation {
+	o := schema.Operation{
+		OperationType: typ, Figi: figi, Currency: "RUB", Status: "Done",
+		Payment: payment, Price: price, Quantity_: quantity, Date: date,
+	}
+	if quantity != 0 {
+		o.Trades = []schema.Trade{{Date: date, Price: price, Quantity: quantity}}
+	}
+	return emulator.Operation{Operation: o}
+}
+
+func TestReconcile(t *testing.T) {
+	sc := &emulator.Scenario{
+		Instruments: []emulator.Instrument{
+			{Figi: "FIGI1", Ticker: "TCK", Type: "Stock", Currency: "RUB", Lot: 1,
+				Prices: []emulator.PricePoint{{Date: "2020/01/01", Price: 100}, {Date: "2020/06/01", Price: 120}}},
+			// split 1:10 in 2021, which the broker does not show in the old operations
+			{Figi: "FIGI2", Ticker: "VTBE", Type: "Etf", Currency: "RUB", Lot: 1,
+				Prices: []emulator.PricePoint{{Date: "2020/01/01", Price: 50}}},
+		},
+		Operations: []emulator.Operation{
+			op("PayIn", "", 10000, 0, 0, "2020-01-10T10:00:00Z"),
+			op("Buy", "FIGI1", -1000, 100, 10, "2020-01-10T11:00:00Z"),
+			op("Buy", "FIGI1", -1100, 110, 10, "2020-02-10T11:00:00Z"),
+			op("Sell", "FIGI1", 600, 120, 5, "2020-03-10T11:00:00Z"),
+			op("Buy", "FIGI2", -500, 50, 10, "2020-03-10T11:00:00Z"),
+		},
+	}
+
+	p, stop := testPortfolio(t, sc)
+	defer stop()
+
+	if err := p.Collect(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err := p.ReconcilePositions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 1 || ds[0].Ticker != "VTBE" || ds[0].What != "quantity" || ds[0].Ours != 100 || ds[0].Broker != 10 {
+		t.Errorf("discrepancies: %v", ds)
+	}
+
+	diffs, err := p.CheckCash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Currency != "RUB" || diffs[0].Diff() != 0 || diffs[0].Reported != 8000 {
+		t.Errorf("cash: %v", diffs)
+	}
+}
@@ -1,28 +1,5 @@
 package portfolio
 
-import (
-	"time"
-
-	log "github.com/sirupsen/logrus"
-)
-
-/* this file is a jail for #repayment_hacks, however some wont even fit here,
-   so introduce a hashtag lol.
-   The general problem is that tnk API provides to little info about bonds */
-
-func (p *Portfolio) addStaticRepayments() {
-	if pinfo, ok := p.positions["BBG00GW0RM55"]; ok {
-		dates := []string{"2019/12/10", "2020/03/10"}
-		for _, date := range dates {
-			t, err := time.Parse("2006/01/02", date)
-			if err != nil {
-				log.Fatal(err)
-			}
-			pinfo.AddRepayment(t, 83)
-		}
-	}
-}
-
 // gotta calc them repayments first, to be able to get correct prices
 // when calculating balances
 func (p *Portfolio) preprocessOperations() {
@@ -39,6 +16,7 @@ func (p *Portfolio) preprocessOperations() {
 
 		if op.IsTrading() {
 			amounts[op.Figi] += op.Quantity()
+			p.addPosition(op)
 
 		} else if op.OperationType == "PartRepayment" {
 			pinfo := p.addPosition(op)
@@ -46,13 +24,9 @@ func (p *Portfolio) preprocessOperations() {
 		}
 	}
 
-	// Temporary fixup:
-	// The problem is that the repayment multiplier don't work for
-	//  - amortized bonds
-	//  - that were open at some t1 (point we want to know balance at)
-	//  - but were all sold at some point t2
-	//  - and there were more repayments from t2 till now
-	// ..because there seems to be no way to get their partrepayment stats after the selling point
-	// Maybe extrapolate the previous repayments?
-	p.addStaticRepayments()
+	// The operations show no repayments after the bond is sold,
+	// while they matter for the prices of the time it was held
+	for _, pinfo := range p.positions {
+		pinfo.AddScheduledRepayments()
+	}
 }
@@ -0,0 +1,110 @@
+package portfolio
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"../aux"
+)
+
+/* Risk of the story series. The values are the time-weighted return index,
+   so the payins do not count as returns. */
+
+type seriesPoint struct {
+	t     time.Time
+	index float64 // 1 + the time-weighted return by t
+}
+
+func numOrNA(v float64) string {
+	if math.IsNaN(v) {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.2f", v)
+}
+
+// benchmarks are the ones of the instruments ever held
+func (p *Portfolio) benchmarks() []string {
+	seen := make(map[string]bool)
+	var tickers []string
+	for _, pinfo := range p.positions {
+		if bench := pinfo.Ins.Benchmark(); bench != "" && !seen[bench] {
+			seen[bench] = true
+			tickers = append(tickers, bench)
+		}
+	}
+	sort.Strings(tickers)
+	return tickers
+}
+
+// benchmarkValues are the RUB prices of the ticker at the times; false if some are missing
+func (p *Portfolio) benchmarkValues(ticker string, times []time.Time) ([]float64, bool) {
+	ins, err := p.tryInsByTicker(ticker)
+	if err != nil {
+		log.Warnf("no benchmark %s: %s", ticker, err)
+		return nil, false
+	}
+
+	var values []float64
+	for _, t := range times {
+		price, err := p.cc.TryGet(ins.Figi, t)
+		if err != nil {
+			log.Warnf("no benchmark %s price at %s: %s", ticker, t.Format("2006/01/02"), err)
+			return nil, false
+		}
+		values = append(values, price*p.cc.Xchgrate(ins.Currency, "RUB", t))
+	}
+	return values, true
+}
+
+func (p *Portfolio) printRisk() {
+	fmt.Println("== Risk ==")
+
+	if len(p.series) < 3 {
+		fmt.Println("  too few points")
+		return
+	}
+
+	var times []time.Time
+	var values []float64
+	for _, pt := range p.series {
+		times = append(times, pt.t)
+		values = append(values, pt.index)
+	}
+
+	returns := aux.Returns(values)
+	years := times[len(times)-1].Sub(times[0]).Hours() / 24 / 365
+	periods := float64(len(returns)) / years
+
+	dd, peak, trough := aux.MaxDrawdown(values)
+
+	fmt.Printf("  %d returns, %.1f a year\n", len(returns), periods)
+	fmt.Printf("  volatility %.1f%% annual\n", aux.Volatility(returns, periods)*100)
+	if peak < 0 {
+		fmt.Println("  max drawdown none")
+	} else {
+		fmt.Printf("  max drawdown %.1f%% (%s -> %s)\n", dd*100,
+			times[peak].Format("2006/01/02"), times[trough].Format("2006/01/02"))
+	}
+	fmt.Printf("  sharpe %s, sortino %s (risk-free %.1f%%)\n",
+		numOrNA(aux.Sharpe(returns, p.config.riskFree, periods)),
+		numOrNA(aux.Sortino(returns, p.config.riskFree, periods)),
+		p.config.riskFree*100)
+
+	for _, ticker := range p.benchmarks() {
+		bvalues, ok := p.benchmarkValues(ticker, times)
+		if !ok {
+			continue
+		}
+		market := aux.Returns(bvalues)
+		if len(market) != len(returns) {
+			log.Warnf("benchmark %s has gaps, skipping it", ticker)
+			continue
+		}
+		fmt.Printf("  vs %-5s beta %s, correlation %s\n",
+			ticker, numOrNA(aux.Beta(returns, market)), numOrNA(aux.Correlation(returns, market)))
+	}
+}
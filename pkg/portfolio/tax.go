@@ -0,0 +1,177 @@
+package portfolio
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"../aux"
+	"../schema"
+)
+
+/* NDFL estimate, per account, the way the broker as the tax agent computes it:
+    - trading: realized gains of the year in RUB, FIFO lots, commissions deducted,
+      losses offset the gains of the same account; lots held over 3 years are exempt (LDV)
+    - dividends and coupons: the tax due vs the TaxDividend/TaxCoupon withheld.
+   It is an estimate: the LDV limit of 3M RUB per year of holding is not applied,
+   and the 15% bracket is applied per account, while it is per person. */
+
+const (
+	ndflRate     = 0.13
+	ndflHighRate = 0.15
+
+	ldvYears = 3
+)
+
+// ndflHighBase is the RUB base the 15% bracket starts above, 0 for none
+func ndflHighBase(year int) float64 {
+	switch {
+	case year < 2021:
+		return 0
+	case year < 2025:
+		return 5000000
+	default:
+		return 2400000
+	}
+}
+
+func ndfl(base float64, year int) float64 {
+	if base <= 0 {
+		return 0
+	}
+	high := ndflHighBase(year)
+	if high == 0 || base <= high {
+		return base * ndflRate
+	}
+	return high*ndflRate + (base-high)*ndflHighRate
+}
+
+// saleGains splits the RUB gain of the sale into the taxable part and the one exempt by LDV
+func saleGains(s schema.Sale) (taxable, exempt float64) {
+	for _, lot := range s.Lots {
+		proceeds := s.ProceedsRub * float64(lot.Quantity) / float64(s.Quantity)
+		gain := proceeds - lot.CostRub
+
+		if gain > 0 && !s.Date.Before(lot.Date.AddDate(ldvYears, 0, 0)) {
+			exempt += gain
+		} else {
+			taxable += gain
+		}
+	}
+	return
+}
+
+type TaxReport struct {
+	Account string
+
+	Gains       float64 // taxable realized gains, losses included
+	Exempt      float64 // by LDV
+	Commissions float64 // service ones, deducted from the gains
+	Base        float64
+	Tax         float64
+	Withheld    float64 // on trading, by the broker so far
+
+	Income         float64 // dividends and coupons
+	IncomeTax      float64
+	IncomeWithheld float64
+}
+
+func (r TaxReport) IncomeDue() float64 {
+	return math.Max(0, r.IncomeTax-r.IncomeWithheld)
+}
+
+// forAccount is a fresh portfolio of the same source and settings, but of a single account
+func (p *Portfolio) forAccount(acc string) *Portfolio {
+	return p.forAccounts([]string{acc})
+}
+
+func (p *Portfolio) forAccounts(accs []string) *Portfolio {
+	return NewPortfolio(p.ctx, p.src, accs, "", "").
+		WithCandleStore(p.store).
+		WithActions(p.config.actions).
+		WithBonds(p.config.bonds).
+		WithLotMethod(schema.LotFifo)
+}
+
+func (p *Portfolio) taxReport(year int) (TaxReport, error) {
+	p.cc = p.newCandleCache()
+
+	_, err := p.processOperations(func(bal *schema.Balance, opTime time.Time) bool {
+		return opTime.Year() <= year
+	})
+	if err != nil {
+		return TaxReport{}, err
+	}
+
+	r := TaxReport{Account: p.accs[0]}
+
+	for _, s := range p.realized(year) {
+		taxable, exempt := saleGains(s.Sale)
+		r.Gains += taxable
+		r.Exempt += exempt
+	}
+
+	for _, op := range p.data.ops {
+		if op.Status != "Done" || op.DateParsed.Year() != year {
+			continue
+		}
+		rub := op.Payment * p.cc.Xchgrate(op.Currency, "RUB", op.DateParsed)
+
+		switch {
+		case aux.IsIn(op.OperationType, "Dividend", "Coupon"):
+			r.Income += rub
+		case aux.IsIn(op.OperationType, "TaxDividend", "TaxCoupon"):
+			r.IncomeWithheld -= rub
+		case aux.IsIn(op.OperationType, "Tax", "TaxLucre", "TaxBack"):
+			r.Withheld -= rub
+		case op.OperationType == "ServiceCommission":
+			r.Commissions -= rub
+		}
+	}
+
+	r.Base = math.Max(0, r.Gains-r.Commissions)
+	r.Tax = ndfl(r.Base, year)
+	r.IncomeTax = ndfl(r.Income, year)
+	return r, p.ctx.Err()
+}
+
+// ListTax prints the NDFL estimate of year per account.
+// Returns the context error if it was interrupted.
+func (p *Portfolio) ListTax(year int) error {
+	var total TaxReport
+
+	for _, acc := range p.accs {
+		r, err := p.forAccount(acc).taxReport(year)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("== %s, %d ==\n", accountName(acc), year)
+		printTax(r)
+
+		total.Gains += r.Gains
+		total.Exempt += r.Exempt
+		total.Commissions += r.Commissions
+		total.Base += r.Base
+		total.Tax += r.Tax
+		total.Withheld += r.Withheld
+		total.Income += r.Income
+		total.IncomeTax += r.IncomeTax
+		total.IncomeWithheld += r.IncomeWithheld
+	}
+
+	if len(p.accs) > 1 {
+		fmt.Printf("== total, %d ==\n", year)
+		printTax(total)
+	}
+	return p.ctx.Err()
+}
+
+func printTax(r TaxReport) {
+	fmt.Printf("  trading:  gains %12.2f, exempt (LDV) %12.2f, commissions %10.2f\n",
+		r.Gains, r.Exempt, r.Commissions)
+	fmt.Printf("            base  %12.2f, tax %12.2f, withheld %12.2f, due %12.2f\n",
+		r.Base, r.Tax, r.Withheld, r.Tax-r.Withheld)
+	fmt.Printf("  income:   %12.2f, tax %12.2f, withheld %12.2f, due %12.2f\n",
+		r.Income, r.IncomeTax, r.IncomeWithheld, r.IncomeDue())
+}
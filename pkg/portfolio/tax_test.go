@@ -0,0 +1,80 @@
+package portfolio
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"../emulator"
+	"../schema"
+)
+
+func TestNdfl(t *testing.T) {
+	for _, c := range []struct {
+		base float64
+		year int
+		exp  float64
+	}{
+		{-100, 2022, 0},
+		{1000, 2022, 130},
+		{6000000, 2020, 780000},
+		{6000000, 2021, 650000 + 150000},
+		{4000000, 2024, 520000},
+		{2000000, 2025, 260000},
+		{4000000, 2025, 312000 + 240000},
+	} {
+		if tax := ndfl(c.base, c.year); math.Abs(tax-c.exp) > 1e-6 {
+			t.Errorf("ndfl(%.0f, %d) = %.2f, exp %.2f", c.base, c.year, tax, c.exp)
+		}
+	}
+}
+
+func TestSaleGains(t *testing.T) {
+	date := func(y int) time.Time {
+		return time.Date(y, 3, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	s := schema.Sale{
+		Date:        date(2023),
+		Quantity:    30,
+		ProceedsRub: 3000,
+		Lots: []schema.Lot{
+			{Date: date(2019), Quantity: 10, CostRub: 500},  // held long enough: +500 exempt
+			{Date: date(2020), Quantity: 10, CostRub: 1200}, // held long enough, but a loss: -200
+			{Date: date(2021), Quantity: 10, CostRub: 400},  // +600
+		},
+	}
+
+	if taxable, exempt := saleGains(s); taxable != 400 || exempt != 500 {
+		t.Errorf("taxable %.2f, exempt %.2f, exp 400, 500", taxable, exempt)
+	}
+}
+
+func TestTaxRepayment(t *testing.T) {
+	sc := &emulator.Scenario{
+		Instruments: []emulator.Instrument{
+			// half of the 1000 nominal repaid
+			{Figi: "BOND1", Ticker: "RU000BOND1", Type: "Bond", Currency: "RUB", Lot: 1, FaceValue: 500,
+				Prices: []emulator.PricePoint{{Date: "2020/01/01", Price: 1010}, {Date: "2020/03/10", Price: 520}}},
+		},
+		Operations: []emulator.Operation{
+			op("PayIn", "", 20000, 0, 0, "2020-01-10T10:00:00Z"),
+			op("Buy", "BOND1", -10100, 1010, 10, "2020-01-10T11:00:00Z"),
+			op("Coupon", "BOND1", 300, 0, 0, "2020-02-01T10:00:00Z"),
+			op("PartRepayment", "BOND1", 5000, 0, 0, "2020-03-10T10:00:00Z"),
+			op("Sell", "BOND1", 5200, 520, 10, "2020-06-10T11:00:00Z"),
+		},
+	}
+
+	p, stop := testPortfolio(t, sc)
+	defer stop()
+
+	r, err := p.taxReport(2020)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the repayment sells half of the cost: 5000 - 10100/2, then 5200 - 10100/2
+	if math.Abs(r.Gains-100) > 1e-6 || math.Abs(r.Income-300) > 1e-6 || math.Abs(r.Base-100) > 1e-6 {
+		t.Errorf("gains %.2f, income %.2f, base %.2f, exp 100, 300, 100", r.Gains, r.Income, r.Base)
+	}
+}
@@ -10,9 +10,14 @@ import (
 )
 
 func (p *Portfolio) Print(at time.Time) {
+	if p.split() {
+		p.printAccounts(at)
+	}
+
 	fmt.Println("== Totals ==")
 
 	p.balance.Print(at, "", "")
+	p.balance.PrintTwr()
 
 	fmt.Printf(" alpha: %s (%.1f%%)\n",
 		p.alphas, aux.Ratio2Perc(p.alphaCorrectedAssets()/p.payins()))
@@ -32,6 +37,24 @@ func (p *Portfolio) Print(at time.Time) {
 		}
 		fmt.Print("  " + pinfo.StringPretty() + "\n")
 	})
+
+	if list := p.unclassified(); len(list) != 0 {
+		fmt.Println("== Unclassified (not in the section shares; see --sections) ==")
+		for _, ins := range list {
+			fmt.Printf("  %s %s %s %s: %s\n", ins.Ticker, ins.Figi, ins.Type, ins.Currency, ins.Name)
+		}
+	}
+}
+
+// unclassified are the instruments ever held without a section
+func (p *Portfolio) unclassified() []schema.Instrument {
+	var list []schema.Instrument
+	p.forSortedPositions(func(pinfo *schema.PositionInfo) {
+		if !pinfo.Ins.IsClassified() {
+			list = append(list, pinfo.Ins)
+		}
+	})
+	return list
 }
 
 func (p *Portfolio) forSortedPositions(cb func(pinfo *schema.PositionInfo)) {
@@ -0,0 +1,255 @@
+package schema
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/* Corporate actions the broker does not reflect in the old operations and candles:
+   splits, reverse splits, ticker/figi changes, conversions and delistings.
+   They come from actions.json, built in, or from a file of the same format:
+
+{
+  "version": 1,
+  "actions": [
+    {"type": "split", "ticker": "VTBE", "date": "2021/04/12", "from": 1, "to": 10},
+    {"type": "conversion", "figi": "OLD", "newFigi": "NEW", "newTicker": "NTCK", "date": "2022/01/10", "from": 2, "to": 1},
+    {"type": "delisting", "figi": "GONE", "date": "2022/03/01"}
+  ]
+}
+
+An action applies to the figi, or to the ticker if there is no figi;
+"from" old units became "to" new ones at the start of the date. */
+
+//go:embed actions.json
+var builtinActions []byte
+
+const actionsVersion = 1
+
+type ActionType string
+
+const (
+	ActionSplit        ActionType = "split"
+	ActionReverseSplit ActionType = "reverse_split"
+	ActionRename       ActionType = "rename"
+	ActionConversion   ActionType = "conversion"
+	ActionDelisting    ActionType = "delisting"
+)
+
+type CorporateAction struct {
+	Type      ActionType `json:"type"`
+	Figi      string     `json:"figi"`
+	Ticker    string     `json:"ticker"`
+	Date      string     `json:"date"`
+	From      int        `json:"from"`
+	To        int        `json:"to"`
+	NewFigi   string     `json:"newFigi"`
+	NewTicker string     `json:"newTicker"`
+
+	date time.Time
+}
+
+func (ca CorporateAction) matches(figi, ticker string) bool {
+	if ca.Figi != "" {
+		return ca.Figi == figi
+	}
+	return ca.Ticker == ticker
+}
+
+func (ca CorporateAction) String() string {
+	name := ca.Figi
+	if name == "" {
+		name = ca.Ticker
+	}
+	return fmt.Sprintf("%s %s %s", ca.Date, ca.Type, name)
+}
+
+func (ca *CorporateAction) validate() error {
+	var err error
+	if ca.date, err = time.Parse("2006/01/02", ca.Date); err != nil {
+		return err
+	}
+	if ca.Figi == "" && ca.Ticker == "" {
+		return fmt.Errorf("no figi or ticker")
+	}
+
+	ratio := func() error {
+		if ca.From < 1 || ca.To < 1 {
+			return fmt.Errorf("bad ratio %d:%d", ca.From, ca.To)
+		}
+		return nil
+	}
+	renames := ca.NewFigi != "" || ca.NewTicker != ""
+
+	switch ca.Type {
+	case ActionSplit:
+		if err = ratio(); err == nil && ca.To <= ca.From {
+			err = fmt.Errorf("split %d:%d is not one", ca.From, ca.To)
+		}
+	case ActionReverseSplit:
+		if err = ratio(); err == nil && ca.To >= ca.From {
+			err = fmt.Errorf("reverse split %d:%d is not one", ca.From, ca.To)
+		}
+	case ActionRename:
+		if !renames {
+			err = fmt.Errorf("no newFigi or newTicker")
+		}
+	case ActionConversion:
+		if err = ratio(); err == nil && (ca.Figi == "" || ca.NewFigi == "") {
+			err = fmt.Errorf("conversion needs figi and newFigi")
+		}
+	case ActionDelisting:
+		if renames || ca.From != 0 || ca.To != 0 {
+			err = fmt.Errorf("delisting has no ratio or new names")
+		}
+	default:
+		err = fmt.Errorf("unknown type %q", ca.Type)
+	}
+
+	if err == nil && (ca.Type == ActionSplit || ca.Type == ActionReverseSplit) && renames {
+		err = fmt.Errorf("splits do not rename, add a rename")
+	}
+	return err
+}
+
+// numerator and denominator of the quantity multiplier
+func (ca CorporateAction) ratio() (int, int) {
+	if ca.From == 0 {
+		return 1, 1
+	}
+	return ca.To, ca.From
+}
+
+type Actions struct {
+	Version int               `json:"version"`
+	Actions []CorporateAction `json:"actions"`
+}
+
+// ParseActions validates the actions and orders them by date
+func ParseActions(data []byte) (*Actions, error) {
+	a := &Actions{}
+	if err := json.Unmarshal(data, a); err != nil {
+		return nil, err
+	}
+	if a.Version != actionsVersion {
+		return nil, fmt.Errorf("unsupported version %d, expected %d", a.Version, actionsVersion)
+	}
+
+	seen := make(map[string]bool)
+	for i := range a.Actions {
+		ca := &a.Actions[i]
+		if err := ca.validate(); err != nil {
+			return nil, fmt.Errorf("action %d (%s): %s", i+1, ca, err)
+		}
+		if seen[ca.String()] {
+			return nil, fmt.Errorf("action %d (%s): duplicate", i+1, ca)
+		}
+		seen[ca.String()] = true
+	}
+
+	sort.SliceStable(a.Actions, func(i, j int) bool {
+		return a.Actions[i].date.Before(a.Actions[j].date)
+	})
+	return a, nil
+}
+
+// LoadActions reads the actions file, the built in one for ""
+func LoadActions(fname string) (*Actions, error) {
+	if fname == "" {
+		return ParseActions(builtinActions)
+	}
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	a, err := ParseActions(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fname, err)
+	}
+	return a, nil
+}
+
+func DefaultActions() *Actions {
+	a, err := LoadActions("")
+	if err != nil {
+		log.Fatalf("built in actions: %s", err)
+	}
+	return a
+}
+
+// follow calls f for every action the instrument went through after t, following the renames;
+// returns the figi and ticker it has in the end. nil Actions are none.
+func (a *Actions) follow(figi, ticker string, t time.Time, f func(CorporateAction)) (string, string) {
+	if a == nil {
+		return figi, ticker
+	}
+
+	for _, ca := range a.Actions {
+		if !t.Before(ca.date) || !ca.matches(figi, ticker) {
+			continue
+		}
+		if f != nil {
+			f(ca)
+		}
+		if ca.NewFigi != "" {
+			figi = ca.NewFigi
+		}
+		if ca.NewTicker != "" {
+			ticker = ca.NewTicker
+		}
+	}
+	return figi, ticker
+}
+
+// Coef is num/den: how many of the today's units one unit held at t is
+func (a *Actions) Coef(figi, ticker string, t time.Time) (num, den int) {
+	num, den = 1, 1
+	a.follow(figi, ticker, t, func(ca CorporateAction) {
+		n, d := ca.ratio()
+		num *= n
+		den *= d
+	})
+	return
+}
+
+// Quantity converts the quantity held at t to the today's units;
+// fractions left by reverse splits and conversions are dropped, the broker pays them out
+func (a *Actions) Quantity(figi, ticker string, t time.Time, quantity int) int {
+	num, den := a.Coef(figi, ticker, t)
+	if quantity*num%den != 0 {
+		log.Warnf("%s%s: %d at %s is a fraction %d/%d of today's units",
+			figi, ticker, quantity, t.Format("2006/01/02"), quantity*num, den)
+	}
+	return quantity * num / den
+}
+
+// Price converts the price of t to the today's units
+func (a *Actions) Price(figi, ticker string, t time.Time, price float64) float64 {
+	num, den := a.Coef(figi, ticker, t)
+	return price * float64(den) / float64(num)
+}
+
+// Successor is the figi and ticker the instrument of t has today
+func (a *Actions) Successor(figi, ticker string, t time.Time) (string, string) {
+	return a.follow(figi, ticker, t, nil)
+}
+
+// Delisted returns the date the instrument was delisted, if it was
+func (a *Actions) Delisted(figi, ticker string) (time.Time, bool) {
+	if a == nil {
+		return time.Time{}, false
+	}
+	for _, ca := range a.Actions {
+		if ca.Type == ActionDelisting && ca.matches(figi, ticker) {
+			return ca.date, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,92 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuiltinActions(t *testing.T) {
+	a := DefaultActions()
+
+	before := time.Date(2021, 4, 9, 10, 0, 0, 0, time.UTC)
+	after := time.Date(2021, 4, 12, 10, 0, 0, 0, time.UTC)
+
+	if q := a.Quantity("", "VTBE", before, 3); q != 30 {
+		t.Errorf("VTBE before the split: %d, exp 30", q)
+	}
+	if q := a.Quantity("", "VTBE", after, 3); q != 3 {
+		t.Errorf("VTBE after the split: %d, exp 3", q)
+	}
+	if p := a.Price("", "FXUS", before, 5000); p != 50 {
+		t.Errorf("FXUS before the split: %.2f, exp 50", p)
+	}
+}
+
+func TestActions(t *testing.T) {
+	a, err := ParseActions([]byte(`{"version": 1, "actions": [
+		{"type": "conversion", "figi": "OLD", "newFigi": "NEW", "newTicker": "NTCK", "date": "2022/01/10", "from": 2, "to": 1},
+		{"type": "split", "figi": "OLD", "date": "2021/01/10", "from": 1, "to": 10},
+		{"type": "split", "ticker": "NTCK", "date": "2023/01/10", "from": 1, "to": 3},
+		{"type": "delisting", "figi": "GONE", "date": "2022/03/01"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := func(y int) time.Time {
+		return time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	for _, c := range []struct {
+		figi     string
+		ticker   string
+		at       time.Time
+		num, den int
+		succ     string
+	}{
+		{"OLD", "", day(2021), 10 * 3, 2, "NEW"}, // split, converted, split again by the new ticker
+		{"OLD", "", day(2022), 3, 2, "NEW"},
+		{"NEW", "NTCK", day(2022), 3, 1, "NEW"},
+		{"NEW", "", day(2022), 1, 1, "NEW"}, // the split is by the ticker, unknown here
+		{"OLD", "", day(2024), 1, 1, "OLD"},
+	} {
+		num, den := a.Coef(c.figi, c.ticker, c.at)
+		succ, _ := a.Successor(c.figi, c.ticker, c.at)
+		if num != c.num || den != c.den || succ != c.succ {
+			t.Errorf("%s at %d: %d/%d -> %s, exp %d/%d -> %s",
+				c.figi, c.at.Year(), num, den, succ, c.num, c.den, c.succ)
+		}
+	}
+
+	if date, ok := a.Delisted("GONE", ""); !ok || !date.Equal(time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("delisted: %s %v", date, ok)
+	}
+}
+
+func TestActionsValidation(t *testing.T) {
+	for action, exp := range map[string]string{
+		`{"type": "split", "ticker": "X", "date": "2021/01/10", "from": 10, "to": 1}`:                  "is not one",
+		`{"type": "reverse_split", "ticker": "X", "date": "2021/01/10", "from": 0, "to": 1}`:           "bad ratio",
+		`{"type": "split", "date": "2021/01/10", "from": 1, "to": 2}`:                                  "no figi or ticker",
+		`{"type": "split", "ticker": "X", "date": "10.01.2021", "from": 1, "to": 2}`:                   "cannot parse",
+		`{"type": "rename", "ticker": "X", "date": "2021/01/10"}`:                                      "no newFigi",
+		`{"type": "conversion", "ticker": "X", "date": "2021/01/10", "from": 1, "to": 1}`:              "needs figi",
+		`{"type": "delisting", "figi": "X", "date": "2021/01/10", "newFigi": "Y"}`:                     "no ratio",
+		`{"type": "merger", "figi": "X", "date": "2021/01/10"}`:                                        "unknown type",
+		`{"type": "split", "ticker": "X", "date": "2021/01/10", "from": 1, "to": 2, "newTicker": "Y"}`: "do not rename",
+	} {
+		_, err := ParseActions([]byte(`{"version": 1, "actions": [` + action + `]}`))
+		if err == nil || !strings.Contains(err.Error(), exp) {
+			t.Errorf("%s: %v, exp %q", action, err, exp)
+		}
+	}
+
+	dup := `{"type": "delisting", "figi": "X", "date": "2021/01/10"}`
+	if _, err := ParseActions([]byte(`{"version": 1, "actions": [` + dup + `,` + dup + `]}`)); err == nil {
+		t.Error("duplicate passed")
+	}
+	if _, err := ParseActions([]byte(`{"version": 2, "actions": []}`)); err == nil {
+		t.Error("version 2 passed")
+	}
+}
@@ -2,6 +2,7 @@ package schema
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -137,7 +138,7 @@ func (b *Balance) CalcAllAssets(usd, eur float64) float64 {
  USD
  + Assets:
     1. Cash balance
-        1.1 Direct payins
+        1.1 Direct payins, less the payouts
         1.2 Exchanges
         1.3 Sold stocks
         1.4 - Bought stocks
@@ -146,13 +147,13 @@ func (b *Balance) CalcAllAssets(usd, eur float64) float64 {
         1.7 Dividends, coupons & repayments
     2. Open USD positions
  - Payins
-    3. Directs payins
+    3. Directs payins, less the payouts
     4. Exchanges
 
 RUB
  + Assets:
     1. Cash balance
-        1.1 Direct payins
+        1.1 Direct payins, less the payouts
         1.3 Sold stocks & dollars
         1.4 - Bought stocks & dollars
         1.5 - Service commissions
@@ -160,19 +161,20 @@ RUB
         1.7 Dividends, coupons & repayments
     2. Open RUB positions
  - Payins:
-    3. Direct payins
+    3. Direct payins, less the payouts
     5. - Exchanged money
 
 */
 
-func (bal *Balance) AddOperation(op Operation, xchgrate func(curr_from, curr_to string, t time.Time) float64) {
+func (bal *Balance) AddOperation(op Operation, xchgrate Xchgrate) {
 	if op.IsTrading() || op.OperationType == "BrokerCommission" {
 		// not accounted here
 
 	} else if op.IsPayment() {
 		// 1.7
 		bal.Assets[op.Currency].Value += op.Payment
-	} else if op.OperationType == "PayIn" {
+	} else if op.OperationType == "PayIn" || op.OperationType == "PayOut" {
+		// PayOut is negative
 		// 1.1
 		bal.Assets[op.Currency].Value += op.Payment
 		// 3
@@ -221,6 +223,8 @@ func (bal *Balance) AddDeal(deal Deal, figi string) {
 type SectionedBalance struct {
 	Sections map[Section]*Balance
 	Total    *Balance
+
+	Twr *TwrTracker // printed if set
 }
 
 func NewSectionedBalance() SectionedBalance {
@@ -239,9 +243,12 @@ func (sb SectionedBalance) SectionBalance(section Section) *Balance {
 	return b
 }
 
-func (sb SectionedBalance) AddDeal(deal Deal, figi string, section Section) {
-	sb.SectionBalance(section).AddDeal(deal, figi)
-	sb.Total.AddDeal(deal, figi)
+// AddDeal splits the deal over the sections the instrument is made of
+func (sb SectionedBalance) AddDeal(deal Deal, ins Instrument) {
+	for section, w := range ins.Parts() {
+		sb.SectionBalance(section).AddDeal(deal.Part(w), ins.Figi)
+	}
+	sb.Total.AddDeal(deal, ins.Figi)
 }
 
 func (sb SectionedBalance) CalcAllAssets(usd, eur float64) {
@@ -267,7 +274,8 @@ const (
 
 func PrintBalanceHead(style string) {
 	if style == TableStyle {
-		fmt.Println("payins, assets, delta, bonds.rub, bonds.usd, stocks.ru, stocks.em, stocks.us, stocks.dm, pivotdate")
+		fmt.Println("payins, assets, delta, bonds.rub, bonds.usd, stocks.ru, stocks.em, stocks.us, stocks.dm, pivotdate, " +
+			"twr, twr.bonds.rub, twr.bonds.usd, twr.stocks.ru, twr.stocks.em, twr.stocks.us, twr.stocks.dm, gold, twr.gold")
 	}
 }
 
@@ -288,20 +296,138 @@ func (b SectionedBalance) Print(t time.Time, prefix, style string) {
 			b.sectionShare(StockEm),
 			b.sectionShare(StockUs),
 			b.sectionShare(StockDm))
+		if b.Twr != nil {
+			s += fmt.Sprintf(", %.1f", aux.Ratio2Perc(b.Twr.Ratio(b))) + b.Twr.sectionsString(b, style)
+		}
+		// appended, not to shift the columns before it
+		s += fmt.Sprintf(", %.1f", b.sectionShare(Gold))
+		if b.Twr != nil {
+			s += fmt.Sprintf(", %.1f", aux.Ratio2Perc(b.Twr.SectionRatio(b, Gold)))
+		}
 	} else {
 		if prefix != "" {
 			s = prefix + ": "
 		}
-		s += fmt.Sprintf("%7.0f -> %7.0f : %6.0f (%5.1f%%, annual %5.1f%%) "+
-			"bonds {%5.1f(RU) +%5.1f(US)}; stocks {%5.1f(RU) +%5.1f(EM) +%5.1f(US) +%5.1f(DM)}",
+		xirr, err := b.Xirr(t)
+		s += fmt.Sprintf("%7.0f -> %7.0f : %6.0f (%5.1f%%, annual %s) "+
+			"bonds {%5.1f(RU) +%5.1f(US)}; stocks {%5.1f(RU) +%5.1f(EM) +%5.1f(US) +%5.1f(DM)}; gold %5.1f",
 			p, a, d,
-			aux.Ratio2Perc(a/p), b.Total.xirr.Ratio(a, t)*100,
+			aux.Ratio2Perc(a/p), aux.PercOrNA("%5.1f%%", xirr, err),
 			b.sectionShare(BondRu),
 			b.sectionShare(BondUs),
 			b.sectionShare(StockRu),
 			b.sectionShare(StockEm),
 			b.sectionShare(StockUs),
-			b.sectionShare(StockDm))
+			b.sectionShare(StockDm),
+			b.sectionShare(Gold))
+		if b.Twr != nil {
+			s += fmt.Sprintf("; twr %5.1f%% (annual %5.1f%%)", aux.Ratio2Perc(b.Twr.Ratio(b)), b.Twr.Annual(b, t))
+		}
+	}
+	fmt.Println(s)
+}
+
+func (b SectionedBalance) Xirr(t time.Time) (float64, error) {
+	return b.Total.xirr.Ratio(b.Total.Assets["all"].Value, t)
+}
+
+// PrintColumns prints the balances side by side, one column per name
+func PrintColumns(t time.Time, names []string, sbs []SectionedBalance, style string) {
+	type row struct {
+		name  string
+		value func(b SectionedBalance) string
+	}
+	num := func(v float64) string { return fmt.Sprintf("%.0f", v) }
+	perc := func(v float64) string { return fmt.Sprintf("%.1f%%", v) }
+	share := func(s Section) func(b SectionedBalance) string {
+		return func(b SectionedBalance) string { return perc(b.sectionShare(s)) }
+	}
+
+	rows := []row{
+		{"payins", func(b SectionedBalance) string { return num(b.Total.Payins["all"].Value) }},
+		{"assets", func(b SectionedBalance) string { return num(b.Total.Assets["all"].Value) }},
+		{"delta", func(b SectionedBalance) string {
+			return num(b.Total.Assets["all"].Value - b.Total.Payins["all"].Value)
+		}},
+		{"xirr", func(b SectionedBalance) string {
+			xirr, err := b.Xirr(t)
+			return aux.PercOrNA("%.1f%%", xirr, err)
+		}},
+		{"twr", func(b SectionedBalance) string {
+			if b.Twr == nil {
+				return "-"
+			}
+			return perc(aux.Ratio2Perc(b.Twr.Ratio(b)))
+		}},
+		{"bonds.rub", share(BondRu)},
+		{"bonds.usd", share(BondUs)},
+		{"stocks.ru", share(StockRu)},
+		{"stocks.em", share(StockEm)},
+		{"stocks.us", share(StockUs)},
+		{"stocks.dm", share(StockDm)},
+		{"gold", share(Gold)},
+	}
+
+	if style == TableStyle {
+		fmt.Println("item, " + strings.Join(names, ", "))
+		for _, r := range rows {
+			s := r.name
+			for _, b := range sbs {
+				s += ", " + r.value(b)
+			}
+			fmt.Println(s)
+		}
+		return
+	}
+
+	s := fmt.Sprintf("  %-10s", "")
+	for _, name := range names {
+		s += fmt.Sprintf(" %12s", name)
 	}
 	fmt.Println(s)
+	for _, r := range rows {
+		s := fmt.Sprintf("  %-10s", r.name)
+		for _, b := range sbs {
+			s += fmt.Sprintf(" %12s", r.value(b))
+		}
+		fmt.Println(s)
+	}
+}
+
+func PrintColumnsHead(names []string, style string) {
+	if style == TableStyle {
+		s := "pivotdate"
+		for _, name := range names {
+			s += fmt.Sprintf(", %s.payins, %s.assets, %s.delta", name, name, name)
+		}
+		fmt.Println(s)
+	}
+}
+
+// PrintColumnsRow is a line of the story with the balances side by side
+func PrintColumnsRow(t time.Time, names []string, sbs []SectionedBalance, style string) {
+	date := t.Format("2006/01/02")
+	if style == TableStyle {
+		s := date
+		for _, b := range sbs {
+			p, a := b.Total.Payins["all"].Value, b.Total.Assets["all"].Value
+			s += fmt.Sprintf(", %.0f, %.0f, %.0f", p, a, a-p)
+		}
+		fmt.Println(s)
+		return
+	}
+
+	var cols []string
+	for i, b := range sbs {
+		p, a := b.Total.Payins["all"].Value, b.Total.Assets["all"].Value
+		cols = append(cols, fmt.Sprintf("%s %7.0f -> %7.0f", names[i], p, a))
+	}
+	fmt.Println(date + ": " + strings.Join(cols, " | "))
+}
+
+// PrintTwr prints the time-weighted returns of the sections
+func (b SectionedBalance) PrintTwr() {
+	if b.Twr != nil {
+		fmt.Println(" twr: " + b.Twr.sectionsString(b, ""))
+	}
 }
@@ -0,0 +1,43 @@
+package schema
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBalancePayOut(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2021, 3, d, 0, 0, 0, 0, time.UTC)
+	}
+	xchgrate := func(from, to string, t time.Time) float64 {
+		if from == "USD" {
+			return 70
+		}
+		return 1
+	}
+
+	bal := NewBalance()
+	for _, op := range []Operation{
+		{OperationType: "PayIn", Currency: "RUB", Payment: 1000, DateParsed: day(1)},
+		{OperationType: "PayOut", Currency: "RUB", Payment: -400, DateParsed: day(2)},
+		{OperationType: "PayIn", Currency: "USD", Payment: 10, DateParsed: day(3)},
+		{OperationType: "PayOut", Currency: "USD", Payment: -4, DateParsed: day(4)},
+	} {
+		bal.AddOperation(op, xchgrate)
+	}
+
+	for _, c := range []struct {
+		what     string
+		got, exp float64
+	}{
+		{"RUB assets", bal.Assets["RUB"].Value, 600},
+		{"RUB payins", bal.Payins["RUB"].Value, 600},
+		{"USD assets", bal.Assets["USD"].Value, 6},
+		{"USD payins", bal.Payins["USD"].Value, 6},
+		{"all payins", bal.Payins["all"].Value, 600 + 6*70},
+	} {
+		if c.got != c.exp {
+			t.Errorf("%s: %.2f, exp %.2f", c.what, c.got, c.exp)
+		}
+	}
+}
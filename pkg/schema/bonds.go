@@ -0,0 +1,276 @@
+package schema
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/* Bond schedules: the API tells too little about bonds, there are no past amortizations
+   of a sold bond, and the candles of an amortized one are of the today's nominal.
+   They come from bonds.json, built in, or from a file of the same format:
+
+{
+  "version": 1,
+  "bonds": [
+    {"figi": "BBG00GW0RM55", "isin": "RU000A0ZZ000",
+     "issued": "2019/06/10", "dayCount": "act/365",
+     "coupons": [{"date": "2019/12/10", "value": 23.18}, {"date": "2020/06/10", "rate": 8.5}],
+     "amortizations": [{"date": "2019/12/10", "value": 83}],
+     "reportDelayDays": 1}
+  ]
+}
+
+Values are per bond, in its currency; a coupon may be given by the annual rate, in % of the nominal
+of its period, instead. A schedule applies to the figi, or to the isin if there is no figi.
+Accrued interest (NKD) of a date is the part of the coupon for the days passed in its period,
+counted by dayCount: act/365 (default), act/360 or 30/360; "issued" starts the first period.
+reportDelayDays is how late the broker reports the repayments. */
+
+//go:embed bonds.json
+var builtinBonds []byte
+
+const bondsVersion = 1
+
+type BondPayment struct {
+	Date  string  `json:"date"`
+	Value float64 `json:"value"`
+	Rate  float64 `json:"rate"` // coupons only, annual %
+
+	date time.Time
+}
+
+func (bp BondPayment) Time() time.Time {
+	return bp.date
+}
+
+const (
+	DayCountAct365 = "act/365"
+	DayCountAct360 = "act/360"
+	DayCount30360  = "30/360"
+)
+
+type BondSchedule struct {
+	Figi            string        `json:"figi"`
+	Isin            string        `json:"isin"`
+	Issued          string        `json:"issued"`
+	DayCount        string        `json:"dayCount"`
+	Coupons         []BondPayment `json:"coupons"`
+	Amortizations   []BondPayment `json:"amortizations"`
+	ReportDelayDays int           `json:"reportDelayDays"`
+
+	issued time.Time
+}
+
+func (s BondSchedule) String() string {
+	if s.Figi != "" {
+		return s.Figi
+	}
+	return s.Isin
+}
+
+func parsePayments(list []BondPayment, rates bool) error {
+	for i := range list {
+		bp := &list[i]
+		var err error
+		if bp.date, err = time.Parse("2006/01/02", bp.Date); err != nil {
+			return err
+		}
+		if bp.Rate != 0 {
+			if !rates {
+				return fmt.Errorf("%s: rate is for coupons only", bp.Date)
+			}
+			if bp.Value != 0 || bp.Rate < 0 {
+				return fmt.Errorf("%s: either a value or a positive rate", bp.Date)
+			}
+		} else if bp.Value <= 0 {
+			return fmt.Errorf("%s: bad value %.2f", bp.Date, bp.Value)
+		}
+		if i > 0 && !list[i-1].date.Before(bp.date) {
+			return fmt.Errorf("%s: not after %s", bp.Date, list[i-1].Date)
+		}
+	}
+	return nil
+}
+
+func (s *BondSchedule) validate() error {
+	if s.Figi == "" && s.Isin == "" {
+		return fmt.Errorf("no figi or isin")
+	}
+	if s.ReportDelayDays < 0 {
+		return fmt.Errorf("negative report delay")
+	}
+	if s.DayCount == "" {
+		s.DayCount = DayCountAct365
+	}
+	if s.DayCount != DayCountAct365 && s.DayCount != DayCountAct360 && s.DayCount != DayCount30360 {
+		return fmt.Errorf("unknown day count %q", s.DayCount)
+	}
+	if err := parsePayments(s.Coupons, true); err != nil {
+		return fmt.Errorf("coupons: %s", err)
+	}
+	if err := parsePayments(s.Amortizations, false); err != nil {
+		return fmt.Errorf("amortizations: %s", err)
+	}
+	if s.Issued != "" {
+		var err error
+		if s.issued, err = time.Parse("2006/01/02", s.Issued); err != nil {
+			return err
+		}
+		if len(s.Coupons) > 0 && !s.issued.Before(s.Coupons[0].date) {
+			return fmt.Errorf("issued after the first coupon")
+		}
+	}
+	return nil
+}
+
+// Multiplier is how much more the nominal was at t than the today's one, face
+func (s *BondSchedule) Multiplier(t time.Time, face float64) float64 {
+	if s == nil || face == 0 {
+		return 1
+	}
+	mult := 1.0
+	for _, am := range s.Amortizations {
+		if am.date.After(t) {
+			mult += am.Value / face
+		}
+	}
+	return mult
+}
+
+// days between t1 and t2 by the day count of the schedule
+func (s *BondSchedule) days(t1, t2 time.Time) float64 {
+	if s.DayCount != DayCount30360 {
+		return t2.Sub(t1).Hours() / 24
+	}
+
+	y1, m1, d1 := t1.Date()
+	y2, m2, d2 := t2.Date()
+	if d1 == 31 {
+		d1 = 30
+	}
+	if d2 == 31 && d1 == 30 {
+		d2 = 30
+	}
+	return float64(360*(y2-y1) + 30*(int(m2)-int(m1)) + d2 - d1)
+}
+
+func (s *BondSchedule) basis() float64 {
+	if s.DayCount == DayCountAct365 {
+		return 365
+	}
+	return 360
+}
+
+// Accrued is the accrued interest (NKD) at t of a bond with the today's nominal face;
+// false if t is out of the coupon periods the schedule knows
+func (s *BondSchedule) Accrued(t time.Time, face float64) (float64, bool) {
+	if s == nil {
+		return 0, false
+	}
+
+	start := s.issued
+	for _, c := range s.Coupons {
+		if !t.Before(c.date) {
+			start = c.date
+			continue
+		}
+		if start.IsZero() || t.Before(start) {
+			return 0, false
+		}
+
+		period := s.days(start, c.date)
+		value := c.Value
+		if c.Rate != 0 {
+			nominal := face * s.Multiplier(t, face)
+			value = nominal * c.Rate / 100 * period / s.basis()
+		}
+		return value * s.days(start, t) / period, true
+	}
+	return 0, false
+}
+
+// ReportDate returns when the repayment reported at t has really happened
+func (s *BondSchedule) ReportDate(t time.Time) time.Time {
+	if s == nil {
+		return t
+	}
+	return t.AddDate(0, 0, -s.ReportDelayDays)
+}
+
+type Bonds struct {
+	Version int            `json:"version"`
+	Bonds   []BondSchedule `json:"bonds"`
+}
+
+// ParseBonds validates the schedules
+func ParseBonds(data []byte) (*Bonds, error) {
+	b := &Bonds{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, err
+	}
+	if b.Version != bondsVersion {
+		return nil, fmt.Errorf("unsupported version %d, expected %d", b.Version, bondsVersion)
+	}
+
+	seen := make(map[string]bool)
+	for i := range b.Bonds {
+		s := &b.Bonds[i]
+		if err := s.validate(); err != nil {
+			return nil, fmt.Errorf("bond %d (%s): %s", i+1, s, err)
+		}
+		if seen[s.String()] {
+			return nil, fmt.Errorf("bond %d (%s): duplicate", i+1, s)
+		}
+		seen[s.String()] = true
+	}
+	return b, nil
+}
+
+// LoadBonds reads the schedules file, the built in one for ""
+func LoadBonds(fname string) (*Bonds, error) {
+	if fname == "" {
+		return ParseBonds(builtinBonds)
+	}
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ParseBonds(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fname, err)
+	}
+	return b, nil
+}
+
+func DefaultBonds() *Bonds {
+	b, err := LoadBonds("")
+	if err != nil {
+		log.Fatalf("built in bonds: %s", err)
+	}
+	return b
+}
+
+// Schedule returns nil if the bond has none; nil Bonds have none
+func (b *Bonds) Schedule(figi, isin string) *BondSchedule {
+	if b == nil {
+		return nil
+	}
+	for i, s := range b.Bonds {
+		if s.Figi != "" && s.Figi == figi || s.Figi == "" && isin != "" && s.Isin == isin {
+			return &b.Bonds[i]
+		}
+	}
+	return nil
+}
+
+func sameDay(t1, t2 time.Time) bool {
+	y1, m1, d1 := t1.Date()
+	y2, m2, d2 := t2.Date()
+	return y1 == y2 && m1 == m2 && d1 == d2
+}
@@ -0,0 +1,122 @@
+package schema
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBondSchedule(t *testing.T) {
+	b, err := ParseBonds([]byte(`{"version": 1, "bonds": [
+		{"isin": "RU1", "reportDelayDays": 1,
+		 "amortizations": [{"date": "2020/03/10", "value": 200}, {"date": "2020/06/10", "value": 200}]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.Schedule("FIGI", "") != nil || b.Schedule("", "") != nil {
+		t.Error("matched without the isin")
+	}
+	s := b.Schedule("FIGI", "RU1")
+	if s == nil {
+		t.Fatal("no schedule by isin")
+	}
+
+	day := func(m, d int) time.Time {
+		return time.Date(2020, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+	}
+
+	// the nominal is 600 now
+	for _, c := range []struct {
+		t    time.Time
+		mult float64
+	}{
+		{day(1, 1), 1000.0 / 600},
+		{day(3, 10), 800.0 / 600},
+		{day(7, 1), 1},
+	} {
+		if m := s.Multiplier(c.t, 600); math.Abs(m-c.mult) > 1e-9 {
+			t.Errorf("%s: %.4f, exp %.4f", c.t.Format("01/02"), m, c.mult)
+		}
+	}
+
+	if d := s.ReportDate(day(3, 11)); !d.Equal(day(3, 10)) {
+		t.Errorf("report date %s", d)
+	}
+
+	// the operations show the first repayment only, the position was sold then
+	pinfo := PositionInfo{Ins: Instrument{FaceValue: 600}, Schedule: s}
+	pinfo.AddRepayment(day(3, 10).Add(10*time.Hour), 200)
+	pinfo.AddScheduledRepayments()
+
+	if len(pinfo.Repayments) != 2 {
+		t.Fatalf("%d repayments", len(pinfo.Repayments))
+	}
+	for _, tm := range []time.Time{day(1, 1), day(3, 11), day(7, 1)} {
+		if m, exp := pinfo.RepaymentMultiplier(tm), s.Multiplier(tm, 600); math.Abs(m-exp) > 1e-9 {
+			t.Errorf("%s: position multiplier %.4f, exp %.4f", tm.Format("01/02"), m, exp)
+		}
+	}
+}
+
+func TestBondsValidation(t *testing.T) {
+	if _, err := LoadBonds(""); err != nil {
+		t.Fatalf("built in: %s", err)
+	}
+
+	for bond, exp := range map[string]string{
+		`{"amortizations": []}`:                                                                              "no figi or isin",
+		`{"figi": "X", "reportDelayDays": -1}`:                                                               "negative",
+		`{"figi": "X", "coupons": [{"date": "2020/13/01", "value": 1}]}`:                                     "coupons",
+		`{"figi": "X", "amortizations": [{"date": "2020/01/01", "value": 0}]}`:                               "bad value",
+		`{"figi": "X", "coupons": [{"date": "2020/02/01", "value": 1}, {"date": "2020/01/01", "value": 1}]}`: "not after",
+	} {
+		_, err := ParseBonds([]byte(`{"version": 1, "bonds": [` + bond + `]}`))
+		if err == nil || !strings.Contains(err.Error(), exp) {
+			t.Errorf("%s: %v, exp %q", bond, err, exp)
+		}
+	}
+}
+
+func TestAccrued(t *testing.T) {
+	b, err := ParseBonds([]byte(`{"version": 1, "bonds": [
+		{"figi": "ACT", "issued": "2020/01/01",
+		 "coupons": [{"date": "2020/07/01", "value": 40}, {"date": "2021/01/01", "rate": 10}],
+		 "amortizations": [{"date": "2020/07/01", "value": 500}]},
+		{"figi": "30", "dayCount": "30/360",
+		 "coupons": [{"date": "2020/01/31", "value": 30}, {"date": "2020/07/31", "value": 30}]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := func(y, m, d int) time.Time {
+		return time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+	}
+
+	for _, c := range []struct {
+		figi    string
+		t       time.Time
+		accrued float64
+		ok      bool
+	}{
+		{"ACT", day(2019, 12, 1), 0, false},
+		{"ACT", day(2020, 1, 1), 0, true},
+		{"ACT", day(2020, 4, 1), 40 * 91.0 / 182, true},
+		// nominal 500 since the amortization, 10% a year
+		{"ACT", day(2020, 10, 1), 500 * 0.1 * 92 / 365, true},
+		{"ACT", day(2021, 1, 1), 0, false},
+		{"30", day(2020, 1, 10), 0, false}, // no start of the first period
+		{"30", day(2020, 4, 30), 30 * 90.0 / 180, true},
+	} {
+		s := b.Schedule(c.figi, "")
+		// the nominal is 500 now
+		accrued, ok := s.Accrued(c.t, 500)
+		if ok != c.ok || math.Abs(accrued-c.accrued) > 1e-9 {
+			t.Errorf("%s at %s: %.4f %v, exp %.4f %v",
+				c.figi, c.t.Format("2006/01/02"), accrued, ok, c.accrued, c.ok)
+		}
+	}
+}
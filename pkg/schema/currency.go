@@ -10,6 +10,7 @@ import (
 
 const (
 	FigiUSD = "BBG0013HGFT4"
+	FigiEUR = "BBG0013HJJ31"
 )
 
 /* const */
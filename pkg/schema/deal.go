@@ -40,6 +40,14 @@ func (deal Deal) Value() float64 {
 	return deal.Price.Value*float64(deal.Quantity) + deal.Accrued
 }
 
+// Part is the deal scaled to the share w of a multi-asset instrument
+func (deal Deal) Part(w float64) Deal {
+	deal.Price.Value *= w
+	deal.Accrued *= w
+	deal.Commission *= w
+	return deal
+}
+
 func (deal Deal) CValue() CValue {
 	cv := deal.Price.Mult(float64(deal.Quantity))
 	cv.Value += deal.Accrued
@@ -0,0 +1,88 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+/* Household: the owners of the portfolios to see as one, each with a token of its own:
+
+{
+  "version": 1,
+  "owners": [
+    {"name": "alice", "token": "/home/alice/.tnk-token", "account": "all"},
+    {"name": "bob", "token": "/home/bob/.tnk-token", "account": "iis"}
+  ]
+}
+
+account is broker, iis or all (default), as --account. */
+
+const householdVersion = 1
+
+type Owner struct {
+	Name    string `json:"name"`
+	Token   string `json:"token"`
+	Account string `json:"account"`
+}
+
+type Household struct {
+	Version int     `json:"version"`
+	Owners  []Owner `json:"owners"`
+}
+
+func (o *Owner) validate() error {
+	if o.Name == "" || strings.Contains(o.Name, "/") {
+		return fmt.Errorf("bad name %q", o.Name)
+	}
+	if o.Token == "" {
+		return fmt.Errorf("no token")
+	}
+	if o.Account == "" {
+		o.Account = "all"
+	}
+	if o.Account != "broker" && o.Account != "iis" && o.Account != "all" {
+		return fmt.Errorf("bad account type %q", o.Account)
+	}
+	return nil
+}
+
+// ParseHousehold validates the owners
+func ParseHousehold(data []byte) (*Household, error) {
+	h := &Household{}
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, err
+	}
+	if h.Version != householdVersion {
+		return nil, fmt.Errorf("unsupported version %d, expected %d", h.Version, householdVersion)
+	}
+	if len(h.Owners) == 0 {
+		return nil, fmt.Errorf("no owners")
+	}
+
+	seen := make(map[string]bool)
+	for i := range h.Owners {
+		o := &h.Owners[i]
+		if err := o.validate(); err != nil {
+			return nil, fmt.Errorf("owner %d: %s", i+1, err)
+		}
+		if seen[o.Name] {
+			return nil, fmt.Errorf("owner %d: duplicate %s", i+1, o.Name)
+		}
+		seen[o.Name] = true
+	}
+	return h, nil
+}
+
+func LoadHousehold(fname string) (*Household, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	h, err := ParseHousehold(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fname, err)
+	}
+	return h, nil
+}
@@ -0,0 +1,30 @@
+package schema
+
+import (
+	"testing"
+)
+
+func TestHousehold(t *testing.T) {
+	h, err := ParseHousehold([]byte(`{"version": 1, "owners": [
+		{"name": "alice", "token": "a.token"},
+		{"name": "bob", "token": "b.token", "account": "iis"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Owners) != 2 || h.Owners[0].Account != "all" || h.Owners[1].Account != "iis" {
+		t.Errorf("owners: %v", h.Owners)
+	}
+
+	for _, bad := range []string{
+		`{"version": 2, "owners": [{"name": "alice", "token": "a.token"}]}`,
+		`{"version": 1, "owners": []}`,
+		`{"version": 1, "owners": [{"name": "al/ice", "token": "a.token"}]}`,
+		`{"version": 1, "owners": [{"name": "alice"}]}`,
+		`{"version": 1, "owners": [{"name": "alice", "token": "a.token", "account": "savings"}]}`,
+		`{"version": 1, "owners": [{"name": "alice", "token": "a.token"}, {"name": "alice", "token": "b.token"}]}`,
+	} {
+		if _, err := ParseHousehold([]byte(bad)); err == nil {
+			t.Errorf("no error for %s", bad)
+		}
+	}
+}
@@ -1,13 +1,11 @@
 package schema
 
 import (
-	"time"
+	"fmt"
 
 	log "github.com/sirupsen/logrus"
 
 	"strings"
-
-	"../aux"
 )
 
 type InsType string
@@ -30,6 +28,7 @@ const (
 	StockDm         = "Stock.DM"
 	CashRu          = "Cash.RU"
 	CashUs          = "Cash.US"
+	Gold            = "Gold" // and the other commodities
 )
 
 // TODO why json tags?
@@ -41,8 +40,13 @@ type Instrument struct {
 	Lot       int
 	FaceValue float64 `json:"faceValue"`
 
+	Isin              string  `json:"isin"`
+	MinPriceIncrement float64 `json:"minPriceIncrement"`
+
 	Type    InsType
 	Section Section
+
+	Composition map[Section]float64 // of a multi-asset fund, the weights sum up to 1; nil if it is all Section
 }
 
 func NewInstrument(figi, ticker, name, typ, currency string, faceValue float64, lot int) Instrument {
@@ -60,9 +64,22 @@ func NewInstrument(figi, ticker, name, typ, currency string, faceValue float64,
 	}
 	ins.Type = getInstrumentType(typ, ticker)
 	ins.Section = getSection(ins)
+	ins.Composition = classification.composition(ins.Ticker)
 	return ins
 }
 
+// Instrument is like NewInstrument, but not fatal for unsupported currencies
+func (mi MarketInstrument) Instrument() (Instrument, error) {
+	if !Currencies.Has(mi.Currency) {
+		return Instrument{}, fmt.Errorf("unsupported currency %s (%s)", mi.Currency, mi.Ticker)
+	}
+
+	ins := NewInstrument(mi.Figi, mi.Ticker, mi.Name, mi.Type, mi.Currency, mi.FaceValue, mi.Lot)
+	ins.Isin = mi.Isin
+	ins.MinPriceIncrement = mi.MinPriceIncrement
+	return ins, nil
+}
+
 func getInstrumentType(typ string, ticker string) InsType {
 	if !map[InsType]bool{
 		InsTypeEtf:      true,
@@ -75,48 +92,26 @@ func getInstrumentType(typ string, ticker string) InsType {
 	return InsType(typ)
 }
 
-func splitCoef(ticker string, date time.Time) int {
-	if aux.IsIn(ticker, "VTBB", "VTBE") && date.Before(time.Date(2021, 4, 12, 0, 0, 0, 0, time.UTC)) {
-		return 10
+func (ins Instrument) Benchmark() string {
+	bench, ok := classification.Benchmarks[ins.Section]
+	if !ok {
+		return ""
 	}
-	if aux.IsIn(ticker, "FXDE") && date.Before(time.Date(2021, 9, 7, 0, 0, 0, 0, time.UTC)) {
-		return 100
+	if tb, ok := classification.TickerBenchmarks[ins.Ticker]; ok {
+		bench = tb
 	}
-	if aux.IsIn(ticker, "FXUS", "FXRB", "FXRL") && date.Before(time.Date(2021, 10, 6, 0, 0, 0, 0, time.UTC)) {
-		return 100
+	if bench != ins.Ticker {
+		return bench
 	}
-	return 1
+	return ""
 }
 
-func (ins Instrument) Benchmark() string {
-	if bench, ok := map[Section]string{
-		BondRu:  "VTBB",
-		BondUs:  "FXRU",
-		StockRu: "FXRL",
-		StockEm: "VTBE",
-		// StockDm: "FXDM", // would be nice, but it appeared too recently; cant compare early dates
-		StockDm: "FXUS",
-		StockUs: "FXUS", // see below
-	}[ins.Section]; ok {
-		if bench == "FXUS" && aux.IsIn(ins.Ticker,
-			"AAPL", // 18.1%
-			"MSFT", // 16.3%
-			"GOOG", //  9.6%
-			"FB",   //  6.2%
-			"V",    //  3.6%
-			"MA",   //  2.9%
-			"INTC", //  2.8%
-			"NVDA", //  2.6%
-			"NFLX", //  2.3%
-		) {
-			return "FXIT"
-		}
-		if bench != ins.Ticker {
-			return bench
-		}
+// Parts are the weights of the sections the instrument is made of
+func (ins Instrument) Parts() map[Section]float64 {
+	if ins.Composition != nil {
+		return ins.Composition
 	}
-
-	return ""
+	return map[Section]float64{ins.Section: 1}
 }
 
 func (s Section) Currency() string {
@@ -127,43 +122,7 @@ func (s Section) Currency() string {
 }
 
 func GetEtfSection(ticker string) (Section, bool) {
-	s, ok := map[string]Section{
-		"VTBB": BondRu,
-		"FXRB": BondRu,
-		"TBRU": BondRu,
-
-		// T* funds are (25x4 gold, stocks, long and short bonds)
-		// TODO proper accounting
-		// consider them bonds for now
-		"TRUR": BondRu,
-		"TUSD": BondUs,
-
-		"FXRU": BondUs,
-		"VTBU": BondUs,
-
-		"SBMX": StockRu,
-		"FXRL": StockRu,
-		"TMOS": StockRu,
-
-		"AKNX": StockUs,
-		"FXIT": StockUs,
-		"FXIM": StockUs,
-		"FXUS": StockUs,
-
-		"FXDM": StockDm,
-		"FXDE": StockDm,
-
-		"TECH": StockUs,
-		"TSPX": StockUs,
-		"TIPO": StockUs,
-		"TBIO": StockUs,
-
-		"VTBE": StockEm,
-		"FXCN": StockEm,
-
-		"FXMM": CashRu,
-		"FXTB": CashUs,
-	}[ticker]
+	s, ok := classification.Etfs[ticker]
 	return s, ok
 }
 
@@ -184,7 +143,7 @@ func getSection(ins Instrument) Section {
 	if ins.Type == InsTypeEtf {
 		s, ok := GetEtfSection(ins.Ticker)
 		if !ok {
-			log.Warnf("Uncatched ETF %s", ins.Ticker)
+			log.Warnf("Uncatched ETF %s, add it to the sections", ins.Ticker)
 		}
 		return s
 	}
@@ -0,0 +1,195 @@
+package schema
+
+import (
+	"fmt"
+	"time"
+)
+
+/* Tax lots: every buy is a lot, every sell is matched against the open lots.
+   FIFO is what the Russian tax law prescribes by default; LIFO and the average cost
+   are for comparison. Costs and proceeds include the commissions and the accrued interest,
+   RUB values are at the rates of the deal dates. An amortization of a bond is a sale too:
+   of the repaid share of the nominal of every open lot, while the bonds are still held. */
+
+type LotMethod string
+
+const (
+	LotFifo    LotMethod = "fifo"
+	LotLifo    LotMethod = "lifo"
+	LotAverage LotMethod = "average"
+)
+
+type Lot struct {
+	Date     time.Time
+	Quantity int
+	Cost     float64 // in the deal currency
+	CostRub  float64
+}
+
+// split takes n items out of the lot
+func (lot *Lot) split(n int) Lot {
+	part := Lot{
+		Date:     lot.Date,
+		Quantity: n,
+		Cost:     lot.Cost * float64(n) / float64(lot.Quantity),
+		CostRub:  lot.CostRub * float64(n) / float64(lot.Quantity),
+	}
+
+	lot.Quantity -= n
+	lot.Cost -= part.Cost
+	lot.CostRub -= part.CostRub
+	return part
+}
+
+type Sale struct {
+	Date      time.Time
+	Quantity  int
+	Currency  string
+	Repayment bool // of a part of the nominal of Quantity bonds, which are still held
+
+	Proceeds    float64 // in the deal currency, net of the commission
+	ProceedsRub float64
+
+	Lots []Lot // the bought ones it was matched to
+}
+
+func (s Sale) Cost() (cost, costRub float64) {
+	for _, lot := range s.Lots {
+		cost += lot.Cost
+		costRub += lot.CostRub
+	}
+	return
+}
+
+func (s Sale) Profit() CValue {
+	cost, _ := s.Cost()
+	return NewCValue(s.Proceeds-cost, s.Currency)
+}
+
+func (s Sale) ProfitRub() float64 {
+	_, costRub := s.Cost()
+	return s.ProceedsRub - costRub
+}
+
+func (s Sale) String() string {
+	cost, costRub := s.Cost()
+	what := "sold"
+	if s.Repayment {
+		what = "repaid in part"
+	}
+	return fmt.Sprintf("%s: %d %s for %.2f, cost %.2f = %s (RUB %.2f - %.2f = %.2f)",
+		s.Date.Format("2006/01/02"), s.Quantity, what, s.Proceeds, cost, s.Profit(),
+		s.ProceedsRub, costRub, s.ProfitRub())
+}
+
+type LotBook struct {
+	Method LotMethod
+
+	Open  []Lot // oldest first
+	Sales []Sale
+}
+
+func (b *LotBook) add(deal Deal, xchgrate Xchgrate) {
+	if deal.IsBuy() {
+		b.buy(deal, xchgrate)
+	} else if deal.Quantity < 0 {
+		b.sell(deal, xchgrate)
+	}
+}
+
+func (b *LotBook) buy(deal Deal, xchgrate Xchgrate) {
+	lot := Lot{
+		Date:     deal.Date,
+		Quantity: deal.Quantity,
+		Cost:     deal.Expense(),
+	}
+	lot.CostRub = lot.Cost * xchgrate(deal.Price.Currency, "RUB", deal.Date)
+
+	if b.Method == LotAverage && len(b.Open) > 0 {
+		avg := &b.Open[0]
+		avg.Quantity += lot.Quantity
+		avg.Cost += lot.Cost
+		avg.CostRub += lot.CostRub
+		return
+	}
+
+	b.Open = append(b.Open, lot)
+}
+
+func (b *LotBook) sell(deal Deal, xchgrate Xchgrate) {
+	sale := Sale{
+		Date:     deal.Date,
+		Quantity: -deal.Quantity,
+		Currency: deal.Price.Currency,
+		Proceeds: deal.Profit(),
+	}
+	sale.ProceedsRub = sale.Proceeds * xchgrate(deal.Price.Currency, "RUB", deal.Date)
+
+	for left := sale.Quantity; left > 0 && len(b.Open) > 0; {
+		idx := 0
+		if b.Method == LotLifo {
+			idx = len(b.Open) - 1
+		}
+		lot := &b.Open[idx]
+
+		n := left
+		if lot.Quantity < n {
+			n = lot.Quantity
+		}
+		sale.Lots = append(sale.Lots, lot.split(n))
+		left -= n
+
+		if lot.Quantity == 0 {
+			b.Open = append(b.Open[:idx], b.Open[idx+1:]...)
+		}
+	}
+
+	b.Sales = append(b.Sales, sale)
+}
+
+// repay books an amortization as a sale of the share of the nominal it repays: the proceeds
+// are the payment, the cost is that share of the cost of the open lots, which keep the rest
+func (b *LotBook) repay(date time.Time, share float64, proceeds CValue, xchgrate Xchgrate) {
+	sale := Sale{
+		Date:      date,
+		Currency:  proceeds.Currency,
+		Repayment: true,
+		Proceeds:  proceeds.Value,
+	}
+	sale.ProceedsRub = sale.Proceeds * xchgrate(proceeds.Currency, "RUB", date)
+
+	for i := range b.Open {
+		lot := &b.Open[i]
+		part := Lot{
+			Date:     lot.Date,
+			Quantity: lot.Quantity,
+			Cost:     lot.Cost * share,
+			CostRub:  lot.CostRub * share,
+		}
+		lot.Cost -= part.Cost
+		lot.CostRub -= part.CostRub
+
+		sale.Quantity += part.Quantity
+		sale.Lots = append(sale.Lots, part)
+	}
+
+	b.Sales = append(b.Sales, sale)
+}
+
+// OpenCost is the cost of the lots still held, in the deal currency
+func (b LotBook) OpenCost() float64 {
+	cost := 0.0
+	for _, lot := range b.Open {
+		cost += lot.Cost
+	}
+	return cost
+}
+
+// Realized is the profit of all the sales, in the deal currency
+func (b LotBook) Realized() float64 {
+	profit := 0.0
+	for _, s := range b.Sales {
+		profit += s.Profit().Value
+	}
+	return profit
+}
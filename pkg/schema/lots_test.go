@@ -0,0 +1,130 @@
+package schema
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLots(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	deal := func(d int, price float64, quantity int) Deal {
+		return Deal{Date: day(d), Price: NewCValue(price, "USD"), Quantity: quantity, Commission: -1}
+	}
+	// the dollar costs 70 + day
+	xchgrate := func(from, to string, t time.Time) float64 {
+		return 70 + float64(t.Day())
+	}
+
+	deals := []Deal{
+		deal(1, 10, 10), // cost 101
+		deal(2, 20, 10), // cost 201
+		deal(3, 30, -15),
+	}
+
+	for method, exp := range map[LotMethod][]float64{
+		// cost, cost in RUB
+		LotFifo:    {101 + 100.5, 101*71 + 100.5*72},
+		LotLifo:    {201 + 50.5, 201*72 + 50.5*71},
+		LotAverage: {302 * 15 / 20.0, (101*71 + 201*72) * 15 / 20.0},
+	} {
+		b := LotBook{Method: method}
+		for _, deal := range deals {
+			b.add(deal, xchgrate)
+		}
+
+		if len(b.Sales) != 1 {
+			t.Fatalf("%s: %d sales", method, len(b.Sales))
+		}
+		s := b.Sales[0]
+		cost, costRub := s.Cost()
+
+		if s.Proceeds != 449 || math.Abs(cost-exp[0]) > 1e-9 || math.Abs(costRub-exp[1]) > 1e-6 {
+			t.Errorf("%s: proceeds %.2f, cost %.2f (%.2f RUB), exp 449, %.2f (%.2f RUB)",
+				method, s.Proceeds, cost, costRub, exp[0], exp[1])
+		}
+		if p := s.ProfitRub(); math.Abs(p-(449*73-exp[1])) > 1e-6 {
+			t.Errorf("%s: profit %.2f RUB", method, p)
+		}
+
+		left := 0
+		for _, lot := range b.Open {
+			left += lot.Quantity
+		}
+		if left != 5 {
+			t.Errorf("%s: %d left open", method, left)
+		}
+		if c := b.OpenCost(); math.Abs(c-(302-exp[0])) > 1e-9 {
+			t.Errorf("%s: open cost %.2f", method, c)
+		}
+		if r := b.Realized(); math.Abs(r-(449-exp[0])) > 1e-9 {
+			t.Errorf("%s: realized %.2f", method, r)
+		}
+	}
+}
+
+func TestLotsRepayment(t *testing.T) {
+	date := func(s string) time.Time {
+		t, _ := time.Parse("2006/01/02", s)
+		return t
+	}
+	rub := func(from, to string, t time.Time) float64 {
+		return 1
+	}
+
+	// BBG00GW0RM55: 1000 at first, 83 repaid twice
+	pinfo := PositionInfo{
+		Ins:               Instrument{Figi: "BOND", Ticker: "BOND", FaceValue: 834},
+		AccumulatedIncome: NewCValue(0, "RUB"),
+	}
+	pinfo.AddRepayment(date("2019/12/10"), 83)
+	pinfo.AddRepayment(date("2020/03/10"), 83)
+
+	for _, op := range []Operation{
+		{OperationType: "Buy", Price: 1050, Trades: []Trade{{Quantity: 10}}, Payment: -10500},
+		{OperationType: "PartRepayment", Payment: 830, DateParsed: date("2019/12/10")},
+		{OperationType: "PartRepayment", Payment: 830, DateParsed: date("2020/03/10")},
+		{OperationType: "Sell", Price: 834 * 1.05, Trades: []Trade{{Quantity: 10}}, Payment: 8757},
+	} {
+		op.Status, op.Currency = "Done", "RUB"
+		if op.DateParsed.IsZero() {
+			op.DateParsed = date("2019/06/01")
+			if op.OperationType == "Sell" {
+				op.DateParsed = date("2020/06/01")
+			}
+		}
+		pinfo.AddOperation(op, rub)
+	}
+
+	if len(pinfo.Lots.Sales) != 3 {
+		t.Fatalf("%d sales", len(pinfo.Lots.Sales))
+	}
+	// every repayment is a sale of 83/1000 and then 83/917 of the cost, 10500 * 0.083 either time
+	for _, s := range pinfo.Lots.Sales[:2] {
+		if !s.Repayment || s.Quantity != 10 {
+			t.Errorf("%s: not a repayment of 10", s)
+		}
+		if cost, _ := s.Cost(); math.Abs(cost-871.5) > 1e-6 {
+			t.Errorf("%s: cost %.2f, exp 871.5", s, cost)
+		}
+		if p := s.ProfitRub(); math.Abs(p+41.5) > 1e-6 {
+			t.Errorf("%s: profit %.2f RUB, exp -41.5", s, p)
+		}
+	}
+	s := pinfo.Lots.Sales[2]
+	if cost, costRub := s.Cost(); math.Abs(cost-8757) > 1e-6 || math.Abs(costRub-8757) > 1e-6 {
+		t.Errorf("cost %.2f (%.2f RUB), exp 8757", cost, costRub)
+	}
+	if p := s.ProfitRub(); math.Abs(p) > 1e-6 {
+		t.Errorf("profit %.2f RUB, exp 0", p)
+	}
+	if p := pinfo.Lots.Realized(); math.Abs(p+83) > 1e-6 {
+		t.Errorf("realized %.2f, exp -83", p)
+	}
+	// the repayments are not the income of the story too
+	if pt := NewPositionPoint(&pinfo, date("2020/06/01"), 0); pt.Income != 0 || math.Abs(pt.Realized+83) > 1e-6 {
+		t.Errorf("income %.2f, realized %.2f, exp 0, -83", pt.Income, pt.Realized)
+	}
+}
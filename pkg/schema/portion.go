@@ -2,6 +2,8 @@ package schema
 
 import (
 	"fmt"
+
+	"../aux"
 )
 
 type Portion struct {
@@ -12,7 +14,7 @@ type Portion struct {
 
 	Balance     CValue
 	Yield       float64
-	YieldAnnual float64
+	YieldAnnual float64 // NaN if there is no xirr
 	YieldMarket float64
 }
 
@@ -60,6 +62,6 @@ func (po Portion) String() string {
 	}
 
 	return fmt.Sprintf(
-		"%s: %s (%.1f%%, annual %.1f%%%s)",
-		date, po.Balance, po.Yield, po.YieldAnnual, benchString(po))
+		"%s: %s (%.1f%%, annual %s%s)",
+		date, po.Balance, po.Yield, aux.PercOrNA("%.1f%%", po.YieldAnnual/100, nil), benchString(po))
 }
@@ -2,6 +2,7 @@ package schema
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"time"
 
@@ -30,8 +31,14 @@ type PositionInfo struct {
 	OpenQuantity int
 	OpenDeal     Deal
 
+	Lots LotBook
+
+	Actions  *Actions      // splits etc, the quantities and prices are in the today's units
+	Schedule *BondSchedule // nil if the bond has none
+
 	// TODO commissions are counted here but not included in portion balances and yields
 	AccumulatedIncome CValue
+	Repaid            float64 // the part of AccumulatedIncome that is amortizations
 }
 
 func (pinfo PositionInfo) IsClosed() bool {
@@ -118,7 +125,7 @@ func (pinfo *PositionInfo) addDeal(deal Deal) {
 	}
 }
 
-func (pinfo *PositionInfo) AddOperation(op Operation) (Deal, bool) {
+func (pinfo *PositionInfo) AddOperation(op Operation, xchgrate Xchgrate) (Deal, bool) {
 	log.Debugf("%v", op)
 
 	if op.Status != "Done" {
@@ -126,10 +133,16 @@ func (pinfo *PositionInfo) AddOperation(op Operation) (Deal, bool) {
 	}
 
 	if op.IsTrading() {
+		// the figi is an older one for the operations before a conversion
+		ticker := ""
+		if op.Figi == pinfo.Ins.Figi {
+			ticker = pinfo.Ins.Ticker
+		}
+
 		deal := Deal{
 			Date:       op.DateParsed,
-			Price:      NewCValue(op.Price, op.Currency),
-			Quantity:   op.Quantity() * splitCoef(pinfo.Ins.Ticker, op.DateParsed),
+			Price:      NewCValue(pinfo.Actions.Price(op.Figi, ticker, op.DateParsed, op.Price), op.Currency),
+			Quantity:   pinfo.Actions.Quantity(op.Figi, ticker, op.DateParsed, op.Quantity()),
 			Commission: op.Commission.Value,
 		}
 
@@ -140,6 +153,7 @@ func (pinfo *PositionInfo) AddOperation(op Operation) (Deal, bool) {
 		deal.Accrued = -op.Payment - deal.Price.Value*float64(deal.Quantity)
 
 		pinfo.addDeal(deal)
+		pinfo.Lots.add(deal, xchgrate)
 
 		return deal, true
 
@@ -148,11 +162,17 @@ func (pinfo *PositionInfo) AddOperation(op Operation) (Deal, bool) {
 		pinfo.AccumulatedIncome.Value += op.Payment
 
 	} else if op.IsPayment() {
+		if op.OperationType == "PartRepayment" {
+			pinfo.repay(op, xchgrate)
+		}
 		if op.Currency != pinfo.AccumulatedIncome.Currency {
 			// TODO
 		} else {
 			// income - positive, taxes - negative
 			pinfo.AccumulatedIncome.Value += op.Payment
+			if op.OperationType == "PartRepayment" {
+				pinfo.Repaid += op.Payment
+			}
 			pinfo.Dividends = append(pinfo.Dividends,
 				Dividend{
 					Date:  op.DateParsed,
@@ -169,6 +189,31 @@ func (pinfo *PositionInfo) AddOperation(op Operation) (Deal, bool) {
 	return Deal{}, false
 }
 
+// AveragePrice is the average cost of the open quantity the way the broker counts it:
+// buys move it, sells do not. Accrued interest is not included.
+func (pinfo PositionInfo) AveragePrice() float64 {
+	po := pinfo.openPortion()
+	if po == nil {
+		return 0
+	}
+
+	var cost float64
+	var quantity int
+	for _, deal := range po.Buys {
+		if deal.IsBuy() {
+			cost += deal.Price.Value * float64(deal.Quantity)
+		} else if quantity > 0 {
+			cost += cost / float64(quantity) * float64(deal.Quantity)
+		}
+		quantity += deal.Quantity
+	}
+
+	if quantity <= 0 {
+		return 0
+	}
+	return cost / float64(quantity)
+}
+
 // =============================================================================
 
 func (pinfo *PositionInfo) MakeOpenDeal(date time.Time, pricef func() float64) (deal Deal, ok bool) {
@@ -220,7 +265,11 @@ func (pinfo *PositionInfo) Finalize(benchPricef PriceAt) {
 		// there are fictive deals with 0 quantity
 		if expense != 0 {
 			po.Yield = aux.Ratio2Perc(value / expense)
-			po.YieldAnnual = xirr.Ratio(po.Close.Profit(), po.Close.Date) * 100
+			rate, err := xirr.Ratio(po.Close.Profit(), po.Close.Date)
+			po.YieldAnnual = rate * 100
+			if err != nil {
+				po.YieldAnnual = math.NaN()
+			}
 			// compare with the market ETF
 			if benchPricef != nil {
 				po.YieldMarket = aux.Ratio2Perc(po.benchValue(benchPricef) / expense)
@@ -251,17 +300,62 @@ func (pinfo PositionInfo) Alpha() CValue {
 // TODO these dont look good at all
 
 func (pinfo *PositionInfo) AddRepayment(t time.Time, value float64) {
-	pinfo.Repayments = append(pinfo.Repayments,
-		&RepaymentPoint{
-			Time: t,
-			Mult: 1,
-		})
+	idx := sort.Search(len(pinfo.Repayments), func(i int) bool {
+		return pinfo.Repayments[i].Time.After(t)
+	})
 
-	for _, rep := range pinfo.Repayments {
+	// the point takes the multiplier of the ones after it
+	mult := 1.0
+	if idx < len(pinfo.Repayments) {
+		mult = pinfo.Repayments[idx].Mult
+	}
+
+	pinfo.Repayments = append(pinfo.Repayments, nil)
+	copy(pinfo.Repayments[idx+1:], pinfo.Repayments[idx:])
+	pinfo.Repayments[idx] = &RepaymentPoint{
+		Time: t,
+		Mult: mult,
+	}
+
+	for _, rep := range pinfo.Repayments[:idx+1] {
 		rep.Mult += value / float64(pinfo.Ins.FaceValue)
 	}
 }
 
+// repay books the share of the nominal op repays in the lots; the nominal before it
+// is the today's one with the repayments since then, which AddRepayment has to have added
+func (pinfo *PositionInfo) repay(op Operation, xchgrate Xchgrate) {
+	if pinfo.OpenQuantity <= 0 || pinfo.Ins.FaceValue == 0 {
+		log.Warnf("%s: repayment with no nominal to repay", pinfo.Ins.Ticker)
+		return
+	}
+
+	nominal := pinfo.Ins.FaceValue * pinfo.RepaymentMultiplier(op.DateParsed.Add(-time.Second))
+	share := op.Payment / float64(pinfo.OpenQuantity) / nominal
+	pinfo.Lots.repay(op.DateParsed, math.Min(share, 1), NewCValue(op.Payment, op.Currency), xchgrate)
+}
+
+// AddScheduledRepayments adds the amortizations of the schedule the operations have not shown,
+// e.g. the ones after the position was sold
+func (pinfo *PositionInfo) AddScheduledRepayments() {
+	if pinfo.Schedule == nil {
+		return
+	}
+
+	for _, am := range pinfo.Schedule.Amortizations {
+		seen := false
+		for _, rep := range pinfo.Repayments {
+			if sameDay(rep.Time, am.date) {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			pinfo.AddRepayment(am.date, am.Value)
+		}
+	}
+}
+
 func (pinfo PositionInfo) RepaymentMultiplier(t time.Time) float64 {
 	idx := sort.Search(len(pinfo.Repayments), func(i int) bool {
 		return pinfo.Repayments[i].Time.After(t)
@@ -0,0 +1,51 @@
+package schema
+
+import (
+	"fmt"
+	"time"
+)
+
+// PositionPoint is the state of a position at a time of its story, in the deal currency
+type PositionPoint struct {
+	Time     time.Time
+	Quantity int
+
+	Value      float64 // at the market price, with the accrued interest
+	Cost       float64 // of the open lots
+	Income     float64 // dividends and coupons less the taxes and commissions so far
+	Unrealized float64
+	Realized   float64 // by the lots of the sales and the repayments so far
+}
+
+// NewPositionPoint takes the full price of a piece at t
+func NewPositionPoint(pinfo *PositionInfo, t time.Time, price float64) PositionPoint {
+	pt := PositionPoint{
+		Time:     t,
+		Quantity: pinfo.OpenQuantity,
+		Cost:     pinfo.Lots.OpenCost(),
+		Income:   pinfo.AccumulatedIncome.Value - pinfo.Repaid, // the repayments are sales, in Realized
+		Realized: pinfo.Lots.Realized(),
+	}
+	pt.Value = price * float64(pt.Quantity)
+	if pt.Quantity != 0 {
+		pt.Unrealized = pt.Value - pt.Cost
+	}
+	return pt
+}
+
+func PrintPositionHead(style string) {
+	if style == TableStyle {
+		fmt.Println("ticker, date, quantity, value, cost, income, unrealized, realized, currency")
+	}
+}
+
+func (pt PositionPoint) Print(ins Instrument, style string) {
+	date := pt.Time.Format("2006/01/02")
+	if style == TableStyle {
+		fmt.Printf("%s, %s, %d, %.2f, %.2f, %.2f, %.2f, %.2f, %s\n",
+			ins.Ticker, date, pt.Quantity, pt.Value, pt.Cost, pt.Income, pt.Unrealized, pt.Realized, ins.Currency)
+		return
+	}
+	fmt.Printf("%s: %5d pcs %10.2f, cost %10.2f; income %9.2f, unrealized %9.2f, realized %9.2f %s\n",
+		date, pt.Quantity, pt.Value, pt.Cost, pt.Income, pt.Unrealized, pt.Realized, ins.Currency)
+}
@@ -8,6 +8,7 @@ type PriceF func() float64
 type PriceFigi func(figi string) float64
 type PriceFigiAt func(figi string, t time.Time) float64
 type PriceAt func(time.Time) float64
+type Xchgrate func(currFrom, currTo string, t time.Time) float64
 
 func PriceCurry0(f1 PriceFigi, figi string) PriceF {
 	return func() float64 {
@@ -23,6 +23,18 @@ type PortfolioResponse struct {
 	TrackingID string `json:"trackingId"`
 }
 
+type CurrenciesResponse struct {
+	Payload struct {
+		Currencies []struct {
+			Balance  float64 `json:"balance"`
+			Blocked  float64 `json:"blocked"`
+			Currency string  `json:"currency"`
+		} `json:"currencies"`
+	} `json:"payload"`
+	Status     string `json:"status"`
+	TrackingID string `json:"trackingId"`
+}
+
 type Trade struct {
 	Date     string  `json:"date"`
 	Price    float64 `json:"price"`
@@ -53,6 +65,8 @@ type Operation struct {
 	// Added fields below
 	DateParsed time.Time `json:"-"`
 	Ticker     string    `json:"-"`
+	Account    string    `json:"-"` // brokerAccountId, "" for the default one
+	Transfer   bool      `json:"-"` // PayIn or PayOut between the accounts, not of the money of them all
 }
 
 type OperationsResponse struct {
@@ -86,35 +100,29 @@ type OrderbookResponse struct {
 	TrackingID string `json:"trackingId"`
 }
 
+type MarketInstrument struct {
+	Currency          string  `json:"currency"`
+	Figi              string  `json:"figi"`
+	Isin              string  `json:"isin"`
+	Lot               int     `json:"lot"`
+	MinPriceIncrement float64 `json:"minPriceIncrement"`
+	Name              string  `json:"name"`
+	Ticker            string  `json:"ticker"`
+	FaceValue         float64 `json:"faceValue"`
+	Type              string  `json:"type"`
+}
+
 type SearchByFigiResponse struct {
-	Payload struct {
-		Currency          string  `json:"currency"`
-		Figi              string  `json:"figi"`
-		Isin              string  `json:"isin"`
-		Lot               int     `json:"lot"`
-		MinPriceIncrement float64 `json:"minPriceIncrement"`
-		Name              string  `json:"name"`
-		Ticker            string  `json:"ticker"`
-		FaceValue         float64 `json:"faceValue"`
-		Type              string  `json:"type"`
-	} `json:"payload"`
-	Status     string `json:"status"`
-	TrackingID string `json:"trackingId"`
+	Payload    MarketInstrument `json:"payload"`
+	Status     string           `json:"status"`
+	TrackingID string           `json:"trackingId"`
 }
 
+// also the response of /market/stocks, /market/bonds etc.
 type SearchByTickerResponse struct {
 	Payload struct {
-		Instruments []struct {
-			Currency          string  `json:"currency"`
-			Figi              string  `json:"figi"`
-			Isin              string  `json:"isin"`
-			Lot               int     `json:"lot"`
-			MinPriceIncrement float64 `json:"minPriceIncrement"`
-			Name              string  `json:"name"`
-			Ticker            string  `json:"ticker"`
-			FaceValue         float64 `json:"faceValue"`
-			Type              string  `json:"type"`
-		} `json:"instruments"`
+		Instruments []MarketInstrument `json:"instruments"`
+		Total       int                `json:"total"`
 	} `json:"payload"`
 	Status     string `json:"status"`
 	TrackingID string `json:"trackingId"`
@@ -0,0 +1,174 @@
+package schema
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/* Classification of the instruments the type and currency do not tell the section of,
+   and the benchmarks the positions are compared with. It comes from sections.json, built in,
+   and a file of the same format may add to it or override its entries:
+
+{
+  "version": 1,
+  "etfs": {"FXUS": "Stock.US", "TRUR": "Bond.RU"},
+  "benchmarks": {"Stock.US": "FXUS"},
+  "tickerBenchmarks": {"AAPL": "FXIT"},
+  "compositions": {"TRUR": {"Stock.RU": 25, "Bond.RU": 50, "Gold": 25}}
+}
+
+etfs are the sections of the funds; benchmarks are per section, tickerBenchmarks replace them
+for single tickers, e.g. the largest parts of FXIT. Stock.DM is compared with FXUS, as FXDM appeared too recently.
+compositions are the weights, in %, of the sections a multi-asset fund holds, e.g. the T* ones
+(25x4 gold, stocks, long and short bonds): their values are split over the sections by them,
+while the etfs section is the one they are traded and compared as. */
+
+//go:embed sections.json
+var builtinSections []byte
+
+const sectionsVersion = 1
+
+var knownSections = []Section{BondRu, BondUs, StockRu, StockEm, StockUs, StockDm, CashRu, CashUs, Gold}
+
+func isKnownSection(s Section) bool {
+	for _, known := range knownSections {
+		if s == known {
+			return true
+		}
+	}
+	return false
+}
+
+type Classification struct {
+	Version          int                `json:"version"`
+	Etfs             map[string]Section `json:"etfs"`
+	Benchmarks       map[Section]string `json:"benchmarks"`
+	TickerBenchmarks map[string]string  `json:"tickerBenchmarks"`
+
+	Compositions map[string]map[Section]float64 `json:"compositions"`
+}
+
+// ParseClassification validates the sections
+func ParseClassification(data []byte) (*Classification, error) {
+	c := &Classification{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	if c.Version != sectionsVersion {
+		return nil, fmt.Errorf("unsupported version %d, expected %d", c.Version, sectionsVersion)
+	}
+
+	for ticker, s := range c.Etfs {
+		if !isKnownSection(s) {
+			return nil, fmt.Errorf("etf %s: unknown section %q", ticker, s)
+		}
+	}
+	for s, bench := range c.Benchmarks {
+		if !isKnownSection(s) {
+			return nil, fmt.Errorf("benchmark %s: unknown section %q", bench, s)
+		}
+	}
+	for ticker, comp := range c.Compositions {
+		sum := 0.0
+		for s, w := range comp {
+			if !isKnownSection(s) {
+				return nil, fmt.Errorf("composition of %s: unknown section %q", ticker, s)
+			}
+			if w <= 0 {
+				return nil, fmt.Errorf("composition of %s: bad weight %.2f of %s", ticker, w, s)
+			}
+			sum += w
+		}
+		if math.Abs(sum-100) > 1e-6 {
+			return nil, fmt.Errorf("composition of %s: weights sum up to %.2f%%", ticker, sum)
+		}
+	}
+	return c, nil
+}
+
+// merge adds the entries of c2 to c, replacing the ones of the same keys
+func (c *Classification) merge(c2 *Classification) {
+	if c.Etfs == nil {
+		c.Etfs = make(map[string]Section)
+	}
+	if c.Benchmarks == nil {
+		c.Benchmarks = make(map[Section]string)
+	}
+	if c.TickerBenchmarks == nil {
+		c.TickerBenchmarks = make(map[string]string)
+	}
+	if c.Compositions == nil {
+		c.Compositions = make(map[string]map[Section]float64)
+	}
+
+	for k, v := range c2.Etfs {
+		c.Etfs[k] = v
+	}
+	for k, v := range c2.Benchmarks {
+		c.Benchmarks[k] = v
+	}
+	for k, v := range c2.TickerBenchmarks {
+		c.TickerBenchmarks[k] = v
+	}
+	for k, v := range c2.Compositions {
+		c.Compositions[k] = v
+	}
+}
+
+// LoadClassification reads the file over the built in sections, just the built in ones for ""
+func LoadClassification(fname string) (*Classification, error) {
+	c, err := ParseClassification(builtinSections)
+	if err != nil || fname == "" {
+		return c, err
+	}
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	c2, err := ParseClassification(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fname, err)
+	}
+	c.merge(c2)
+	return c, nil
+}
+
+func DefaultClassification() *Classification {
+	c, err := LoadClassification("")
+	if err != nil {
+		log.Fatalf("built in sections: %s", err)
+	}
+	return c
+}
+
+// composition is in fractions, nil if the ticker has none
+func (c *Classification) composition(ticker string) map[Section]float64 {
+	comp, ok := c.Compositions[ticker]
+	if !ok {
+		return nil
+	}
+	parts := make(map[Section]float64)
+	for s, w := range comp {
+		parts[s] = w / 100
+	}
+	return parts
+}
+
+// classification is what the new instruments get their sections and benchmarks from
+var classification = DefaultClassification()
+
+// UseClassification replaces the built in sections; the instruments made before keep theirs
+func UseClassification(c *Classification) {
+	classification = c
+}
+
+// IsClassified tells if the section of the instrument is known
+func (ins Instrument) IsClassified() bool {
+	return ins.Section != ""
+}
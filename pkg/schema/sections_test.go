@@ -0,0 +1,93 @@
+package schema
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClassification(t *testing.T) {
+	defer UseClassification(DefaultClassification())
+
+	dir, err := ioutil.TempDir("", "sections")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fname := filepath.Join(dir, "sections.json")
+	err = ioutil.WriteFile(fname, []byte(`{"version": 1,
+		"etfs": {"NEWF": "Stock.EM", "FXUS": "Stock.DM"},
+		"benchmarks": {"Stock.DM": "FXDM"},
+		"tickerBenchmarks": {"TSLA": "FXIT"}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadClassification(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseClassification(c)
+
+	for _, e := range []struct {
+		ticker  string
+		typ     InsType
+		section Section
+		bench   string
+	}{
+		{"NEWF", InsTypeEtf, StockEm, "VTBE"}, // added
+		{"FXUS", InsTypeEtf, StockDm, "FXDM"}, // overridden
+		{"VTBB", InsTypeEtf, BondRu, ""},      // built in, its own benchmark
+		{"UNKN", InsTypeEtf, "", ""},
+		{"TSLA", InsTypeStock, StockUs, "FXIT"},
+		{"AAPL", InsTypeStock, StockUs, "FXIT"},
+		{"KO", InsTypeStock, StockUs, "FXUS"},
+	} {
+		currency := "USD"
+		if e.typ == InsTypeEtf {
+			currency = "RUB"
+		}
+		ins := NewInstrument("F"+e.ticker, e.ticker, e.ticker, string(e.typ), currency, 0, 1)
+		if ins.Section != e.section || ins.Benchmark() != e.bench || ins.IsClassified() != (e.section != "") {
+			t.Errorf("%s: %s, %s, exp %s, %s", e.ticker, ins.Section, ins.Benchmark(), e.section, e.bench)
+		}
+	}
+
+	for _, bad := range []string{
+		`{"version": 2}`,
+		`{"version": 1, "etfs": {"OIL": "Oil"}}`,
+		`{"version": 1, "benchmarks": {"Oil": "OIL"}}`,
+		`{"version": 1, "compositions": {"MIX": {"Stock.RU": 50, "Oil": 50}}}`,
+		`{"version": 1, "compositions": {"MIX": {"Stock.RU": 50, "Bond.RU": 40}}}`,
+		`{"version": 1, "compositions": {"MIX": {"Stock.RU": 110, "Bond.RU": -10}}}`,
+	} {
+		if _, err := ParseClassification([]byte(bad)); err == nil {
+			t.Errorf("no error for %s", bad)
+		}
+	}
+}
+
+func TestComposition(t *testing.T) {
+	ins := NewInstrument("FTRUR", "TRUR", "TRUR", string(InsTypeEtf), "RUB", 0, 1)
+	if ins.Section != BondRu || ins.Composition[Gold] != 0.25 {
+		t.Fatalf("TRUR: %s, %v", ins.Section, ins.Composition)
+	}
+
+	sb := NewSectionedBalance()
+	sb.AddDeal(Deal{Price: NewCValue(10, "RUB"), Quantity: 100, Commission: -4}, ins)
+	for section, exp := range map[Section]float64{StockRu: -251, BondRu: -502, Gold: -251} {
+		if v := sb.Sections[section].Assets["RUB"].Value; v != exp {
+			t.Errorf("%s: %.2f, exp %.2f", section, v, exp)
+		}
+	}
+	if v := sb.Total.Assets["RUB"].Value; v != -1004 {
+		t.Errorf("total: %.2f, exp -1004", v)
+	}
+
+	fxgd := NewInstrument("FFXGD", "FXGD", "FXGD", string(InsTypeEtf), "RUB", 0, 1)
+	if parts := fxgd.Parts(); len(parts) != 1 || parts[Gold] != 1 {
+		t.Errorf("FXGD: %v", parts)
+	}
+}
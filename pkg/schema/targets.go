@@ -0,0 +1,117 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+/* Rebalancing targets: the weights of sections or of tickers, in % of the whole portfolio:
+
+{
+  "version": 1,
+  "targets": [
+    {"section": "Stock.US", "ticker": "FXUS", "weight": 40},
+    {"section": "Bond.RU", "ticker": "VTBB", "weight": 30},
+    {"ticker": "SBER", "weight": 10}
+  ]
+}
+
+A section target covers the positions of the section without a target of their own,
+and is bought and sold by its ticker. The rest up to 100% is cash. */
+
+const targetsVersion = 1
+
+type Target struct {
+	Section Section `json:"section"`
+	Ticker  string  `json:"ticker"`
+	Weight  float64 `json:"weight"`
+}
+
+func (t Target) String() string {
+	if t.Section != "" {
+		return fmt.Sprintf("%s (%s)", t.Section, t.Ticker)
+	}
+	return t.Ticker
+}
+
+type Targets struct {
+	Version int      `json:"version"`
+	Targets []Target `json:"targets"`
+}
+
+func (t Target) validate() error {
+	if t.Ticker == "" {
+		return fmt.Errorf("no ticker")
+	}
+	if t.Weight <= 0 || t.Weight > 100 {
+		return fmt.Errorf("bad weight %.2f", t.Weight)
+	}
+	if t.Section != "" && !isKnownSection(t.Section) {
+		return fmt.Errorf("unknown section %s", t.Section)
+	}
+	return nil
+}
+
+// ParseTargets validates the targets
+func ParseTargets(data []byte) (*Targets, error) {
+	ts := &Targets{}
+	if err := json.Unmarshal(data, ts); err != nil {
+		return nil, err
+	}
+	if ts.Version != targetsVersion {
+		return nil, fmt.Errorf("unsupported version %d, expected %d", ts.Version, targetsVersion)
+	}
+	if len(ts.Targets) == 0 {
+		return nil, fmt.Errorf("no targets")
+	}
+
+	sum := 0.0
+	tickers := make(map[string]bool)
+	sections := make(map[Section]bool)
+	for i, t := range ts.Targets {
+		if err := t.validate(); err != nil {
+			return nil, fmt.Errorf("target %d (%s): %s", i+1, t, err)
+		}
+		if tickers[t.Ticker] || t.Section != "" && sections[t.Section] {
+			return nil, fmt.Errorf("target %d (%s): duplicate", i+1, t)
+		}
+		tickers[t.Ticker] = true
+		sections[t.Section] = true
+		sum += t.Weight
+	}
+	if sum > 100+1e-9 {
+		return nil, fmt.Errorf("weights sum up to %.2f%%", sum)
+	}
+	return ts, nil
+}
+
+func LoadTargets(fname string) (*Targets, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := ParseTargets(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fname, err)
+	}
+	return ts, nil
+}
+
+// Covers is the share of a position of the instrument the target includes: all of it for its ticker,
+// the part of the section for the others, as show splits the multi-asset funds
+func (ts *Targets) Covers(t Target, ins Instrument) float64 {
+	if t.Ticker == ins.Ticker {
+		return 1
+	}
+	if t.Section == "" {
+		return 0
+	}
+	for _, other := range ts.Targets {
+		if other.Ticker == ins.Ticker {
+			// a target of its own
+			return 0
+		}
+	}
+	return ins.Parts()[t.Section]
+}
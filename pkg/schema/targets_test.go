@@ -0,0 +1,38 @@
+package schema
+
+import (
+	"testing"
+)
+
+func TestTargets(t *testing.T) {
+	ts, err := ParseTargets([]byte(`{"version": 1, "targets": [
+		{"section": "Stock.US", "ticker": "FXUS", "weight": 40},
+		{"ticker": "AAPL", "weight": 10}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	us := Instrument{Ticker: "FXIT", Section: StockUs}
+	aapl := Instrument{Ticker: "AAPL", Section: StockUs}
+	tusd := Instrument{Ticker: "TUSD", Section: BondUs,
+		Composition: map[Section]float64{StockUs: 0.25, BondUs: 0.5, Gold: 0.25}}
+	if ts.Covers(ts.Targets[0], us) != 1 || ts.Covers(ts.Targets[0], aapl) != 0 || ts.Covers(ts.Targets[1], aapl) != 1 ||
+		ts.Covers(ts.Targets[0], tusd) != 0.25 || ts.Covers(ts.Targets[1], tusd) != 0 {
+		t.Errorf("bad covers")
+	}
+
+	for _, bad := range []string{
+		`{"version": 1, "targets": []}`,
+		`{"version": 1, "targets": [{"weight": 10}]}`,
+		`{"version": 1, "targets": [{"ticker": "SBER", "weight": 0}]}`,
+		`{"version": 1, "targets": [{"section": "Oil", "ticker": "OIL", "weight": 10}]}`,
+		`{"version": 1, "targets": [{"ticker": "SBER", "weight": 60}, {"ticker": "FXUS", "weight": 50}]}`,
+		`{"version": 1, "targets": [{"ticker": "SBER", "weight": 10}, {"ticker": "SBER", "weight": 20}]}`,
+		`{"version": 1, "targets": [{"section": "Stock.US", "ticker": "FXUS", "weight": 10},
+			{"section": "Stock.US", "ticker": "FXIT", "weight": 20}]}`,
+	} {
+		if _, err := ParseTargets([]byte(bad)); err == nil {
+			t.Errorf("no error for %s", bad)
+		}
+	}
+}
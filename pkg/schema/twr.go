@@ -0,0 +1,120 @@
+package schema
+
+import (
+	"fmt"
+	"time"
+
+	"../aux"
+)
+
+/* TwrTracker follows the time-weighted returns of the total and of every section.
+   The cash flows of the total are the payins, the ones of a section are the deals in it
+   and the coupons, dividends and repayments its positions pay out.
+   The periods are closed at the values of the day of the flows, in RUB, or of the times
+   of a story only: the flows in between are taken as made at the start of the period then. */
+
+type TwrTracker struct {
+	total    aux.Twr
+	sections map[Section]*aux.Twr
+
+	start time.Time // of the first flow
+	day   time.Time // of the last mark
+}
+
+func NewTwrTracker() *TwrTracker {
+	return &TwrTracker{
+		sections: make(map[Section]*aux.Twr),
+	}
+}
+
+func (tr *TwrTracker) section(s Section) *aux.Twr {
+	tw := tr.sections[s]
+	if tw == nil {
+		tw = &aux.Twr{}
+		tr.sections[s] = tw
+	}
+	return tw
+}
+
+// NeedsMark is false if the flows of t are of the day already marked
+func (tr *TwrTracker) NeedsMark(t time.Time) bool {
+	return !sameDay(t, tr.day)
+}
+
+// Mark closes the periods at the values of sb, which has to have CalcAllAssets done
+func (tr *TwrTracker) Mark(sb SectionedBalance, t time.Time) {
+	tr.day = t
+	tr.total.Mark(sb.Total.Assets["all"].Value)
+	for s, tw := range tr.sections {
+		value := 0.0
+		if bal := sb.Sections[s]; bal != nil {
+			value = bal.Assets["all"].Value
+		}
+		tw.Mark(value)
+	}
+}
+
+func (tr *TwrTracker) AddPayin(rub float64, t time.Time) {
+	if tr.start.IsZero() {
+		tr.start = t
+	}
+	tr.total.AddFlow(rub)
+}
+
+// AddDeal takes the RUB value of the deal, positive for buys, split over the parts of ins
+func (tr *TwrTracker) AddDeal(ins Instrument, rub float64) {
+	for section, w := range ins.Parts() {
+		tr.section(section).AddFlow(rub * w)
+	}
+}
+
+// AddIncome takes the RUB value a position has paid out, positive for coupons, dividends
+// and repayments, negative for their taxes; it leaves the sections of ins
+func (tr *TwrTracker) AddIncome(ins Instrument, rub float64) {
+	tr.AddDeal(ins, -rub)
+}
+
+// Ratio is 1 + the return of the total till t, where its value is sb's
+func (tr *TwrTracker) Ratio(sb SectionedBalance) float64 {
+	return tr.total.Ratio(sb.Total.Assets["all"].Value)
+}
+
+// Annual is the annualized return of the total till t
+func (tr *TwrTracker) Annual(sb SectionedBalance, t time.Time) float64 {
+	if tr.start.IsZero() || !tr.start.Before(t) {
+		return 0
+	}
+	return aux.Ratio2Perc(aux.RatioAnnual(tr.Ratio(sb), t.Sub(tr.start)))
+}
+
+// SectionRatio is 1 + the return of the section, 1 if it was never held
+func (tr *TwrTracker) SectionRatio(sb SectionedBalance, s Section) float64 {
+	tw := tr.sections[s]
+	if tw == nil {
+		return 1
+	}
+	value := 0.0
+	if bal := sb.Sections[s]; bal != nil {
+		value = bal.Assets["all"].Value
+	}
+	return tw.Ratio(value)
+}
+
+// of the table columns; gold is appended after the others
+var twrSections = []Section{BondRu, BondUs, StockRu, StockEm, StockUs, StockDm}
+
+func (tr *TwrTracker) sectionsString(sb SectionedBalance, style string) string {
+	perc := func(s Section) float64 {
+		return aux.Ratio2Perc(tr.SectionRatio(sb, s))
+	}
+
+	if style == TableStyle {
+		s := ""
+		for _, section := range twrSections {
+			s += fmt.Sprintf(", %.1f", perc(section))
+		}
+		return s
+	}
+	return fmt.Sprintf("bonds {%5.1f%%(RU) %5.1f%%(US)}; stocks {%5.1f%%(RU) %5.1f%%(EM) %5.1f%%(US) %5.1f%%(DM)}; gold %5.1f%%",
+		perc(BondRu), perc(BondUs), perc(StockRu), perc(StockEm), perc(StockUs), perc(StockDm), perc(Gold))
+}
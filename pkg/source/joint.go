@@ -0,0 +1,98 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"../schema"
+)
+
+// Joint is the sources of several owners as one: the accounts are "owner/id",
+// "owner/" for the default one; the market is the one of the first owner
+type Joint struct {
+	Market
+
+	names  []string
+	owners map[string]Source
+}
+
+var _ Source = (*Joint)(nil)
+
+func NewJoint() *Joint {
+	return &Joint{
+		owners: make(map[string]Source),
+	}
+}
+
+func (j *Joint) Add(owner string, src Source) *Joint {
+	if j.Market == nil {
+		j.Market = src
+	}
+	j.names = append(j.names, owner)
+	j.owners[owner] = src
+	return j
+}
+
+// JointAccount is the account of the owner in a Joint
+func JointAccount(owner, acc string) string {
+	return owner + "/" + acc
+}
+
+// SplitAccount is the owner and the account of the owner's source; no owner if acc is not a joint one
+func SplitAccount(acc string) (owner, id string) {
+	if i := strings.Index(acc, "/"); i >= 0 {
+		return acc[:i], acc[i+1:]
+	}
+	return "", acc
+}
+
+func (j *Joint) owner(acc string) (Source, string, error) {
+	owner, id := SplitAccount(acc)
+	src, ok := j.owners[owner]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown owner of account %q", acc)
+	}
+	return src, id, nil
+}
+
+func (j *Joint) RequestOperations(ctx context.Context, start time.Time, acc string) (schema.OperationsResponse, error) {
+	src, id, err := j.owner(acc)
+	if err != nil {
+		return schema.OperationsResponse{}, err
+	}
+	return src.RequestOperations(ctx, start, id)
+}
+
+func (j *Joint) RequestPortfolio(ctx context.Context, acc string) (schema.PortfolioResponse, error) {
+	src, id, err := j.owner(acc)
+	if err != nil {
+		return schema.PortfolioResponse{}, err
+	}
+	return src.RequestPortfolio(ctx, id)
+}
+
+func (j *Joint) RequestCurrencies(ctx context.Context, acc string) (schema.CurrenciesResponse, error) {
+	src, id, err := j.owner(acc)
+	if err != nil {
+		return schema.CurrenciesResponse{}, err
+	}
+	return src.RequestCurrencies(ctx, id)
+}
+
+// RequestAccounts lists the accounts of all the owners
+func (j *Joint) RequestAccounts(ctx context.Context) (schema.AccountsResponse, error) {
+	var all schema.AccountsResponse
+	for _, owner := range j.names {
+		resp, err := j.owners[owner].RequestAccounts(ctx)
+		if err != nil {
+			return all, err
+		}
+		for _, acc := range resp.Payload.Accounts {
+			acc.BrokerAccountID = JointAccount(owner, acc.BrokerAccountID)
+			all.Payload.Accounts = append(all.Payload.Accounts, acc)
+		}
+	}
+	return all, nil
+}
@@ -0,0 +1,86 @@
+package source
+
+import (
+	"context"
+	"time"
+
+	"../schema"
+)
+
+// Interfaces to the market and account data.
+// client.MyClient implements all of them; others may implement only a part,
+// e.g. a price archive, and pass the rest to the client.
+// ctx cancels the request; implementations return its error once it is done.
+
+type Instruments interface {
+	RequestByFigi(ctx context.Context, figi string) (schema.Instrument, error)
+	RequestByTicker(ctx context.Context, ticker string) (schema.Instrument, error)
+}
+
+type Candles interface {
+	RequestCandles(ctx context.Context, figi string, t1, t2 time.Time, interval string) (schema.CandlesResponse, error)
+}
+
+type Prices interface {
+	RequestCurrentPrice(ctx context.Context, figi string) (float64, error)
+}
+
+// Orderbooks are the bids and asks of now
+type Orderbooks interface {
+	RequestOrderbook(ctx context.Context, figi string) (schema.OrderbookResponse, error)
+}
+
+type Operations interface {
+	RequestOperations(ctx context.Context, start time.Time, acc string) (schema.OperationsResponse, error)
+}
+
+type Positions interface {
+	RequestPortfolio(ctx context.Context, acc string) (schema.PortfolioResponse, error)
+	RequestCurrencies(ctx context.Context, acc string) (schema.CurrenciesResponse, error)
+}
+
+type Accounts interface {
+	RequestAccounts(ctx context.Context) (schema.AccountsResponse, error)
+}
+
+// Catalog lists every instrument known to the market
+type Catalog interface {
+	RequestCatalog(ctx context.Context) ([]schema.MarketInstrument, error)
+}
+
+// Market is everything about instruments and their prices
+type Market interface {
+	Instruments
+	Candles
+	Prices
+}
+
+// Source is everything a portfolio needs
+type Source interface {
+	Market
+	Operations
+	Positions
+	Accounts
+}
+
+// WithMarket returns src with the market part replaced by m
+func WithMarket(src Source, m Market) Source {
+	return struct {
+		Market
+		Operations
+		Positions
+		Accounts
+	}{m, src, src, src}
+}
+
+// WithInstruments returns src with the instrument lookups replaced by ins
+func WithInstruments(src Source, ins Instruments) Source {
+	return struct {
+		Instruments
+		Candles
+		Prices
+		Operations
+		Positions
+		Accounts
+	}{ins, src, src, src, src, src}
+}